@@ -1,37 +1,89 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/estevesnp/dsb/pkg/dsbc"
 	"github.com/estevesnp/dsb/pkg/interpreter"
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/optimizer"
 	"github.com/estevesnp/dsb/pkg/repl"
+	"github.com/estevesnp/dsb/pkg/resolver"
 )
 
 func main() {
+	backendName := flag.String("backend", string(interpreter.EvaluatorBackend), "backend that runs programs: eval or vm")
+	optimize := flag.Bool("O", false, "fold constants and drop dead code before running")
+	maxDepth := flag.Int("max-depth", 0, "how many calls can be nested, not counting the evaluator's tail calls, 0 for the backend's default")
+	flag.Parse()
+
+	backend, err := interpreter.ParseBackend(*backendName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
+	newInterpreter := func() *interpreter.Interpreter {
+		interp := interpreter.NewWithBackend(backend)
+		interp.SetOptimize(*optimize)
+		interp.SetLimits(limits.Limits{MaxDepth: *maxDepth})
+		return interp
+	}
+
+	args := flag.Args()
+
 	switch {
 
-	case len(os.Args) == 1 && inputIsPiped():
-		startInterpreter(os.Stdin)
+	case len(args) == 0 && inputIsPiped():
+		startInterpreter(newInterpreter(), os.Stdin)
 
-	case len(os.Args) == 1:
-		startREPL()
+	case len(args) == 0:
+		startREPL(newInterpreter())
+
+	case args[0] == "expand":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: dsb expand <file>")
+			os.Exit(2)
+		}
+		expandFile(args[1], *optimize)
+
+	case args[0] == "check":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: dsb check <file>")
+			os.Exit(2)
+		}
+		checkFile(args[1])
+
+	case args[0] == "build":
+		input, output, ok := parseBuildArgs(args[1:])
+		if !ok {
+			fmt.Fprintln(os.Stderr, "usage: dsb build <file> [-o <output>]")
+			os.Exit(2)
+		}
+		buildFile(newInterpreter(), input, output)
 
 	default:
-		for _, arg := range os.Args[1:] {
-			processFile(arg)
+		interp := newInterpreter()
+		for _, arg := range args {
+			processFile(interp, arg)
 		}
 	}
 }
 
-func startREPL() {
+func startREPL(interp *interpreter.Interpreter) {
 	fmt.Print("this is the Domain Specific Bullshit REPL, have fun\n\n")
-	repl.Start(os.Stdin, os.Stdout)
+	repl.StartWith(interp, os.Stdin, os.Stdout)
 }
 
-func startInterpreter(reader io.Reader) {
-	if err := interpreter.Start(reader); err != nil {
+func startInterpreter(interp *interpreter.Interpreter, reader io.Reader) {
+	if _, err := interp.RunReader(reader); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
@@ -47,12 +99,145 @@ func inputIsPiped() bool {
 	return (stat.Mode() & os.ModeCharDevice) == 0
 }
 
-func processFile(fileName string) {
+func processFile(interp *interpreter.Interpreter, fileName string) {
+	if strings.HasSuffix(fileName, dsbc.Extension) {
+		runCompiledFile(interp, fileName)
+		return
+	}
+
 	file, err := os.Open(fileName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error opening file %q: %v", fileName, err)
 	}
 	defer file.Close()
 
-	startInterpreter(file)
+	startInterpreter(interp, file)
+}
+
+// runCompiledFile runs a program written by dsb build, skipping the lexer,
+// parser and compiler.
+func runCompiledFile(interp *interpreter.Interpreter, fileName string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening file %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	bytecode, err := dsbc.Read(bufio.NewReader(file))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error loading %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+
+	if _, err := interp.RunBytecode(bytecode); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// checkFile prints the undefined identifiers and unused bindings in
+// fileName, exiting with an error if any identifier is undefined.
+func checkFile(fileName string) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening file %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+
+	diagnostics, err := interpreter.New().Check(string(data))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, d := range diagnostics {
+		fmt.Printf("%s:%s\n", fileName, d)
+		failed = failed || d.Kind == resolver.Undefined
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// parseBuildArgs reads the arguments of dsb build. The flag package stops at
+// the first positional argument, so -o is handled here to allow it on either
+// side of the input file.
+func parseBuildArgs(args []string) (input, output string, ok bool) {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-o":
+			if i+1 == len(args) || output != "" {
+				return "", "", false
+			}
+			i++
+			output = args[i]
+		case input == "":
+			input = args[i]
+		default:
+			return "", "", false
+		}
+	}
+
+	if input == "" {
+		return "", "", false
+	}
+
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + dsbc.Extension
+	}
+
+	return input, output, true
+}
+
+// buildFile compiles the program in fileName and writes it to output, so it
+// can later be run with dsb output.
+func buildFile(interp *interpreter.Interpreter, fileName, output string) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening file %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+
+	bytecode, err := interp.Compile(string(data))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	var buf bytes.Buffer
+	if err := dsbc.Write(&buf, bytecode); err != nil {
+		fmt.Fprintf(os.Stderr, "error building %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(output, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %q: %v\n", output, err)
+		os.Exit(1)
+	}
+}
+
+// expandFile prints the program in fileName after macro expansion, and
+// optimization if optimize is set, one top-level statement per line.
+func expandFile(fileName string, optimize bool) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening file %q: %v\n", fileName, err)
+		os.Exit(1)
+	}
+
+	program, err := interpreter.New().Expand(string(data))
+	if err == nil && optimize {
+		program, err = optimizer.Optimize(program)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	for _, stmt := range program.Statements {
+		fmt.Println(stmt.String())
+	}
 }
@@ -77,6 +77,19 @@ func (ls *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	// Binding is where the resolver found the variable this identifier
+	// refers to. It's nil for identifiers that haven't been resolved or
+	// don't name a variable, which are looked up by name instead.
+	Binding *Binding
+}
+
+// Binding locates a variable Depth functions out from where it's used. Slot
+// is its index in that function's Scope, or -1 for a global, which is still
+// looked up by name once the right environment is reached.
+type Binding struct {
+	Depth int
+	Slot  int
 }
 
 func (i *Identifier) expressionNode() {}
@@ -164,6 +177,22 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
 // StringLiteral
 type StringLiteral struct {
 	Token token.Token
@@ -210,7 +239,12 @@ func (al *ArrayLiteral) String() string {
 // MapLiteral
 type MapLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []*MapPair
+}
+
+type MapPair struct {
+	Key   Expression
+	Value Expression
 }
 
 func (ml *MapLiteral) expressionNode() {}
@@ -223,8 +257,8 @@ func (ml *MapLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := make([]string, 0, len(ml.Pairs))
-	for key, value := range ml.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s:%s", key.String(), value.String()))
+	for _, pair := range ml.Pairs {
+		pairs = append(pairs, fmt.Sprintf("%s:%s", pair.Key.String(), pair.Value.String()))
 	}
 
 	out.WriteString("{")
@@ -234,6 +268,33 @@ func (ml *MapLiteral) String() string {
 	return out.String()
 }
 
+// SetLiteral
+type SetLiteral struct {
+	Token    token.Token
+	Elements []Expression
+}
+
+func (sl *SetLiteral) expressionNode() {}
+
+func (sl *SetLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+
+func (sl *SetLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := make([]string, len(sl.Elements))
+	for idx, el := range sl.Elements {
+		elements[idx] = el.String()
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
 // PrefixExpression
 type PrefixExpression struct {
 	Token    token.Token
@@ -309,6 +370,31 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// MemberExpression
+type MemberExpression struct {
+	Token    token.Token
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Boolean
 type Boolean struct {
 	Token token.Token
@@ -382,6 +468,15 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+
+	// Scope is filled in by the resolver, nil until then.
+	Scope *Scope
+}
+
+// Scope lists the names of a function's local variables in slot order, its
+// parameters first.
+type Scope struct {
+	Names []string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -0,0 +1,183 @@
+package ast
+
+// Copy returns a deep copy of node, so the copy can be modified without
+// touching the original tree.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+
+	case *BlockStatement:
+		return copyBlock(node)
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+
+	case *LetStatement:
+		return &LetStatement{
+			Token: node.Token,
+			Name:  copyIdentifier(node.Name),
+			Value: copyExpression(node.Value),
+		}
+
+	case *Identifier:
+		return copyIdentifier(node)
+
+	case *NullLiteral:
+		return &NullLiteral{Token: node.Token}
+
+	case *IntegerLiteral:
+		return &IntegerLiteral{Token: node.Token, Value: node.Value}
+
+	case *FloatLiteral:
+		return &FloatLiteral{Token: node.Token, Value: node.Value}
+
+	case *StringLiteral:
+		return &StringLiteral{Token: node.Token, Value: node.Value}
+
+	case *Boolean:
+		return &Boolean{Token: node.Token, Value: node.Value}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *SetLiteral:
+		return &SetLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+
+	case *MapLiteral:
+		pairs := make([]*MapPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			pairs[i] = &MapPair{Key: copyExpression(pair.Key), Value: copyExpression(pair.Value)}
+		}
+		return &MapLiteral{Token: node.Token, Pairs: pairs}
+
+	case *PrefixExpression:
+		return &PrefixExpression{
+			Token:    node.Token,
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+
+	case *InfixExpression:
+		return &InfixExpression{
+			Token:    node.Token,
+			Left:     copyExpression(node.Left),
+			Operator: node.Operator,
+			Right:    copyExpression(node.Right),
+		}
+
+	case *IndexExpression:
+		return &IndexExpression{
+			Token: node.Token,
+			Left:  copyExpression(node.Left),
+			Index: copyExpression(node.Index),
+		}
+
+	case *MemberExpression:
+		return &MemberExpression{
+			Token:    node.Token,
+			Object:   copyExpression(node.Object),
+			Property: copyIdentifier(node.Property),
+		}
+
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+
+	case *FunctionLiteral:
+		return &FunctionLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+		}
+
+	case *MacroLiteral:
+		return &MacroLiteral{
+			Token:      node.Token,
+			Parameters: copyIdentifiers(node.Parameters),
+			Body:       copyBlock(node.Body),
+		}
+
+	case *CallExpression:
+		return &CallExpression{
+			Token:     node.Token,
+			Function:  copyExpression(node.Function),
+			Arguments: copyExpressions(node.Arguments),
+		}
+
+	default:
+		return node
+	}
+}
+
+func copyStatements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+
+	copied := make([]Statement, len(stmts))
+	for i, stmt := range stmts {
+		copied[i], _ = Copy(stmt).(Statement)
+	}
+
+	return copied
+}
+
+func copyExpressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+
+	copied := make([]Expression, len(exps))
+	for i, exp := range exps {
+		copied[i] = copyExpression(exp)
+	}
+
+	return copied
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+
+	copied, _ := Copy(exp).(Expression)
+	return copied
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+
+	return copied
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+
+	return &Identifier{Token: ident.Token, Value: ident.Value}
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements)}
+}
@@ -1,66 +1,221 @@
 package ast
 
+import "fmt"
+
 type ModifierFunc func(Node) Node
 
-func Modify(node Node, modifier ModifierFunc) Node {
+type ModifyError struct {
+	Parent   Node
+	Expected string
+	Got      Node
+}
+
+func (me *ModifyError) Error() string {
+	return fmt.Sprintf("modifier returned %T inside %T, expected %s", me.Got, me.Parent, me.Expected)
+}
+
+func Modify(node Node, modifier ModifierFunc) (Node, error) {
+	return Apply(node, nil, modifier)
+}
+
+// Apply is like Modify, but first calls pre on each node, if pre is not nil.
+// When pre returns false the node is kept as is: neither its children nor
+// the node itself are passed to modifier.
+func Apply(node Node, pre func(Node) bool, modifier ModifierFunc) (Node, error) {
+	if pre != nil && !pre(node) {
+		return node, nil
+	}
+
+	var err error
+
 	switch node := node.(type) {
 
 	case *Program:
-		for i, statement := range node.Statements {
-			node.Statements[i], _ = Modify(statement, modifier).(Statement)
-		}
+		node.Statements, err = modifyStatements(node, node.Statements, pre, modifier)
 
 	case *BlockStatement:
-		for i, statement := range node.Statements {
-			node.Statements[i], _ = Modify(statement, modifier).(Statement)
-		}
+		node.Statements, err = modifyStatements(node, node.Statements, pre, modifier)
 
-	case *FunctionLiteral:
-		for i, param := range node.Parameters {
-			node.Parameters[i] = Modify(param, modifier).(*Identifier)
+	case *ExpressionStatement:
+		node.Expression, err = modifyExpression(node, node.Expression, pre, modifier)
+
+	case *ReturnStatement:
+		node.ReturnValue, err = modifyExpression(node, node.ReturnValue, pre, modifier)
+
+	case *LetStatement:
+		if node.Name, err = modifyIdentifier(node, node.Name, pre, modifier); err != nil {
+			return nil, err
 		}
-		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+		node.Value, err = modifyExpression(node, node.Value, pre, modifier)
 
 	case *ArrayLiteral:
-		for i, elem := range node.Elements {
-			node.Elements[i] = Modify(elem, modifier).(Expression)
-		}
+		node.Elements, err = modifyExpressions(node, node.Elements, pre, modifier)
+
+	case *SetLiteral:
+		node.Elements, err = modifyExpressions(node, node.Elements, pre, modifier)
 
 	case *MapLiteral:
-		newPairs := make(map[Expression]Expression)
-		for key, value := range node.Pairs {
-			newKey, _ := Modify(key, modifier).(Expression)
-			newValue, _ := Modify(value, modifier).(Expression)
-			newPairs[newKey] = newValue
+		for _, pair := range node.Pairs {
+			if pair.Key, err = modifyExpression(node, pair.Key, pre, modifier); err != nil {
+				return nil, err
+			}
+			if pair.Value, err = modifyExpression(node, pair.Value, pre, modifier); err != nil {
+				return nil, err
+			}
 		}
-		node.Pairs = newPairs
 
-	case *ExpressionStatement:
-		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+	case *PrefixExpression:
+		node.Right, err = modifyExpression(node, node.Right, pre, modifier)
 
 	case *InfixExpression:
-		node.Left, _ = Modify(node.Left, modifier).(Expression)
-		node.Right, _ = Modify(node.Right, modifier).(Expression)
-
-	case *PrefixExpression:
-		node.Right, _ = Modify(node.Right, modifier).(Expression)
+		if node.Left, err = modifyExpression(node, node.Left, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Right, err = modifyExpression(node, node.Right, pre, modifier)
 
 	case *IndexExpression:
-		node.Left, _ = Modify(node.Left, modifier).(Expression)
-		node.Index, _ = Modify(node.Index, modifier).(Expression)
+		if node.Left, err = modifyExpression(node, node.Left, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Index, err = modifyExpression(node, node.Index, pre, modifier)
+
+	case *MemberExpression:
+		if node.Object, err = modifyExpression(node, node.Object, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Property, err = modifyIdentifier(node, node.Property, pre, modifier)
 
 	case *IfExpression:
-		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
-		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
-		node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		if node.Condition, err = modifyExpression(node, node.Condition, pre, modifier); err != nil {
+			return nil, err
+		}
+		if node.Consequence, err = modifyBlock(node, node.Consequence, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Alternative, err = modifyBlock(node, node.Alternative, pre, modifier)
 
-	case *ReturnStatement:
-		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *FunctionLiteral:
+		if node.Parameters, err = modifyIdentifiers(node, node.Parameters, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Body, err = modifyBlock(node, node.Body, pre, modifier)
 
-	case *LetStatement:
-		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *MacroLiteral:
+		if node.Parameters, err = modifyIdentifiers(node, node.Parameters, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Body, err = modifyBlock(node, node.Body, pre, modifier)
+
+	case *CallExpression:
+		if node.Function, err = modifyExpression(node, node.Function, pre, modifier); err != nil {
+			return nil, err
+		}
+		node.Arguments, err = modifyExpressions(node, node.Arguments, pre, modifier)
+
+	case *Identifier, *NullLiteral, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+
+	default:
+		return nil, fmt.Errorf("cannot modify node of type %T", node)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return modifier(node), nil
+}
+
+func modifyStatements(parent Node, stmts []Statement, pre func(Node) bool, modifier ModifierFunc) ([]Statement, error) {
+	for i, stmt := range stmts {
+		modified, err := Apply(stmt, pre, modifier)
+		if err != nil {
+			return nil, err
+		}
+
+		s, ok := modified.(Statement)
+		if !ok {
+			return nil, &ModifyError{Parent: parent, Expected: "statement", Got: modified}
+		}
+		stmts[i] = s
+	}
+
+	return stmts, nil
+}
+
+func modifyExpressions(parent Node, exps []Expression, pre func(Node) bool, modifier ModifierFunc) ([]Expression, error) {
+	for i, exp := range exps {
+		modified, err := modifyExpression(parent, exp, pre, modifier)
+		if err != nil {
+			return nil, err
+		}
+		exps[i] = modified
+	}
+
+	return exps, nil
+}
+
+func modifyExpression(parent Node, exp Expression, pre func(Node) bool, modifier ModifierFunc) (Expression, error) {
+	if exp == nil {
+		return nil, nil
+	}
+
+	modified, err := Apply(exp, pre, modifier)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := modified.(Expression)
+	if !ok {
+		return nil, &ModifyError{Parent: parent, Expected: "expression", Got: modified}
+	}
+
+	return e, nil
+}
+
+func modifyIdentifiers(parent Node, idents []*Identifier, pre func(Node) bool, modifier ModifierFunc) ([]*Identifier, error) {
+	for i, ident := range idents {
+		modified, err := modifyIdentifier(parent, ident, pre, modifier)
+		if err != nil {
+			return nil, err
+		}
+		idents[i] = modified
+	}
+
+	return idents, nil
+}
+
+func modifyIdentifier(parent Node, ident *Identifier, pre func(Node) bool, modifier ModifierFunc) (*Identifier, error) {
+	if ident == nil {
+		return nil, nil
+	}
+
+	modified, err := Apply(ident, pre, modifier)
+	if err != nil {
+		return nil, err
+	}
+
+	i, ok := modified.(*Identifier)
+	if !ok {
+		return nil, &ModifyError{Parent: parent, Expected: "identifier", Got: modified}
+	}
+
+	return i, nil
+}
+
+func modifyBlock(parent Node, block *BlockStatement, pre func(Node) bool, modifier ModifierFunc) (*BlockStatement, error) {
+	if block == nil {
+		return nil, nil
+	}
+
+	modified, err := Apply(block, pre, modifier)
+	if err != nil {
+		return nil, err
+	}
 
+	b, ok := modified.(*BlockStatement)
+	if !ok {
+		return nil, &ModifyError{Parent: parent, Expected: "block statement", Got: modified}
 	}
 
-	return modifier(node)
+	return b, nil
 }
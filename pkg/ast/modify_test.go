@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -117,33 +118,177 @@ func TestModify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&SetLiteral{Elements: []Expression{one(), two()}},
+			&SetLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&CallExpression{
+				Function:  &IndexExpression{Left: one(), Index: one()},
+				Arguments: []Expression{one(), &PrefixExpression{Operator: "-", Right: one()}},
+			},
+			&CallExpression{
+				Function:  &IndexExpression{Left: two(), Index: two()},
+				Arguments: []Expression{two(), &PrefixExpression{Operator: "-", Right: two()}},
+			},
+		},
+		{
+			&MemberExpression{Object: one(), Property: &Identifier{Value: "x"}},
+			&MemberExpression{Object: two(), Property: &Identifier{Value: "x"}},
+		},
+		{
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&MacroLiteral{
+				Parameters: []*Identifier{{Value: "x"}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
-		modified := Modify(tt.input, turnOneIntoTwo)
+		modified, err := Modify(tt.input, turnOneIntoTwo)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
 		if !reflect.DeepEqual(modified, tt.expected) {
 			t.Errorf("not equal. got %+v, want %+v", modified, tt.expected)
 		}
 	}
 
 	mapLiteral := &MapLiteral{
-		Pairs: map[Expression]Expression{
-			one(): one(),
-			one(): one(),
+		Pairs: []*MapPair{
+			{Key: one(), Value: one()},
+			{Key: one(), Value: one()},
 		},
 	}
 
-	Modify(mapLiteral, turnOneIntoTwo)
+	if _, err := Modify(mapLiteral, turnOneIntoTwo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
-	for key, val := range mapLiteral.Pairs {
-		key, _ := key.(*IntegerLiteral)
+	for _, pair := range mapLiteral.Pairs {
+		key, _ := pair.Key.(*IntegerLiteral)
 		if key.Value != 2 {
 			t.Errorf("value is not %d, got %d", 2, key.Value)
 		}
 
-		val, _ := val.(*IntegerLiteral)
+		val, _ := pair.Value.(*IntegerLiteral)
 		if val.Value != 2 {
 			t.Errorf("value is not %d, got %d", 2, val.Value)
 		}
 	}
 }
+
+func TestModifyWrongNodeKind(t *testing.T) {
+	statementToExpression := func(node Node) Node {
+		if stmt, ok := node.(*ExpressionStatement); ok {
+			return stmt.Expression
+		}
+
+		return node
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &IntegerLiteral{Value: 1}},
+		},
+	}
+
+	_, err := Modify(program, statementToExpression)
+
+	var modifyErr *ModifyError
+	if !errors.As(err, &modifyErr) {
+		t.Fatalf("expected *ModifyError, got %T (%v)", err, err)
+	}
+
+	if modifyErr.Expected != "statement" {
+		t.Errorf("wrong expected kind. want %q, got %q", "statement", modifyErr.Expected)
+	}
+
+	if _, ok := modifyErr.Got.(*IntegerLiteral); !ok {
+		t.Errorf("wrong offending node. got %T", modifyErr.Got)
+	}
+
+	expressionToStatement := func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok && ident.Value == "x" {
+			return &ExpressionStatement{Expression: ident}
+		}
+
+		return node
+	}
+
+	call := &CallExpression{
+		Function:  &Identifier{Value: "f"},
+		Arguments: []Expression{&Identifier{Value: "x"}},
+	}
+
+	if _, err := Modify(call, expressionToStatement); err == nil {
+		t.Fatalf("expected an error when an argument becomes a statement")
+	}
+}
+
+func TestApplySkipsRejectedNodes(t *testing.T) {
+	skipped := &CallExpression{
+		Function:  &Identifier{Value: "quote"},
+		Arguments: []Expression{&IntegerLiteral{Value: 1}},
+	}
+	program := &Program{Statements: []Statement{
+		&ExpressionStatement{Expression: &IntegerLiteral{Value: 1}},
+		&ExpressionStatement{Expression: skipped},
+	}}
+
+	notQuote := func(node Node) bool {
+		call, ok := node.(*CallExpression)
+		return !ok || call != skipped
+	}
+
+	_, err := Apply(program, notQuote, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			return &IntegerLiteral{Value: integer.Value + 1}
+		}
+		return node
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	first := program.Statements[0].(*ExpressionStatement).Expression.(*IntegerLiteral)
+	if first.Value != 2 {
+		t.Errorf("expected first literal to be modified, got %d", first.Value)
+	}
+
+	inner := skipped.Arguments[0].(*IntegerLiteral)
+	if inner.Value != 1 {
+		t.Errorf("expected skipped literal to be left alone, got %d", inner.Value)
+	}
+}
@@ -0,0 +1,62 @@
+package ast
+
+import "github.com/estevesnp/dsb/pkg/token"
+
+// Pos returns the position where node starts in the source, or an invalid
+// position for nodes that were built without one.
+func Pos(node Node) token.Position {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) == 0 {
+			return token.Position{}
+		}
+		return Pos(node.Statements[0])
+	case *LetStatement:
+		return node.Token.Pos
+	case *ReturnStatement:
+		return node.Token.Pos
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			return Pos(node.Expression)
+		}
+		return node.Token.Pos
+	case *BlockStatement:
+		return node.Token.Pos
+	case *Identifier:
+		return node.Token.Pos
+	case *NullLiteral:
+		return node.Token.Pos
+	case *IntegerLiteral:
+		return node.Token.Pos
+	case *FloatLiteral:
+		return node.Token.Pos
+	case *StringLiteral:
+		return node.Token.Pos
+	case *Boolean:
+		return node.Token.Pos
+	case *ArrayLiteral:
+		return node.Token.Pos
+	case *MapLiteral:
+		return node.Token.Pos
+	case *SetLiteral:
+		return node.Token.Pos
+	case *PrefixExpression:
+		return node.Token.Pos
+	case *InfixExpression:
+		return Pos(node.Left)
+	case *IndexExpression:
+		return Pos(node.Left)
+	case *MemberExpression:
+		return Pos(node.Object)
+	case *IfExpression:
+		return node.Token.Pos
+	case *FunctionLiteral:
+		return node.Token.Pos
+	case *MacroLiteral:
+		return node.Token.Pos
+	case *CallExpression:
+		return Pos(node.Function)
+	default:
+		return token.Position{}
+	}
+}
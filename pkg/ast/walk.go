@@ -0,0 +1,134 @@
+package ast
+
+// Visitor's Visit method is called for every node found by Walk. If it
+// returns a non-nil visitor w, Walk visits the node's children with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect walks the tree in depth-first order, calling f for each node and
+// skipping a node's children when f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Children returns the direct, non-nil children of node in source order.
+func Children(node Node) []Node {
+	var children []Node
+
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if !isNilNode(n) {
+				children = append(children, n)
+			}
+		}
+	}
+
+	switch node := node.(type) {
+
+	case *Program:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			add(stmt)
+		}
+
+	case *ExpressionStatement:
+		add(node.Expression)
+
+	case *ReturnStatement:
+		add(node.ReturnValue)
+
+	case *LetStatement:
+		add(node.Name, node.Value)
+
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+
+	case *SetLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+
+	case *MapLiteral:
+		for _, pair := range node.Pairs {
+			add(pair.Key, pair.Value)
+		}
+
+	case *PrefixExpression:
+		add(node.Right)
+
+	case *InfixExpression:
+		add(node.Left, node.Right)
+
+	case *IndexExpression:
+		add(node.Left, node.Index)
+
+	case *MemberExpression:
+		add(node.Object, node.Property)
+
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			add(param)
+		}
+		add(node.Body)
+
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			add(param)
+		}
+		add(node.Body)
+
+	case *CallExpression:
+		add(node.Function)
+		for _, arg := range node.Arguments {
+			add(arg)
+		}
+	}
+
+	return children
+}
+
+func isNilNode(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,118 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "f"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "x"}},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ReturnStatement{
+								ReturnValue: &InfixExpression{
+									Left:     &Identifier{Value: "x"},
+									Operator: "+",
+									Right:    &IntegerLiteral{Value: 1},
+								},
+							},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{
+				Expression: &CallExpression{
+					Function:  &Identifier{Value: "f"},
+					Arguments: []Expression{&IntegerLiteral{Value: 2}},
+				},
+			},
+		},
+	}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			visited = append(visited, fmt.Sprintf("%T", node))
+		}
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement",
+		"*ast.Identifier",
+		"*ast.FunctionLiteral",
+		"*ast.Identifier",
+		"*ast.BlockStatement",
+		"*ast.ReturnStatement",
+		"*ast.InfixExpression",
+		"*ast.Identifier",
+		"*ast.IntegerLiteral",
+		"*ast.ExpressionStatement",
+		"*ast.CallExpression",
+		"*ast.Identifier",
+		"*ast.IntegerLiteral",
+	}
+
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong visiting order.\nwant %v\ngot  %v", expected, visited)
+	}
+}
+
+func TestInspectSkipsChildren(t *testing.T) {
+	node := &IfExpression{
+		Condition: &Boolean{Value: true},
+		Consequence: &BlockStatement{
+			Statements: []Statement{
+				&ExpressionStatement{Expression: &IntegerLiteral{Value: 1}},
+			},
+		},
+	}
+
+	count := 0
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			return false
+		}
+
+		count += 1
+		_, isBlock := n.(*BlockStatement)
+		return !isBlock
+	})
+
+	if count != 3 {
+		t.Errorf("wrong number of visited nodes. want %d, got %d", 3, count)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	original := &CallExpression{
+		Function: &Identifier{Value: "f"},
+		Arguments: []Expression{
+			&MapLiteral{Pairs: []*MapPair{{Key: &StringLiteral{Value: "a"}, Value: &IntegerLiteral{Value: 1}}}},
+		},
+	}
+
+	copied := Copy(original).(*CallExpression)
+
+	if !reflect.DeepEqual(original, copied) {
+		t.Fatalf("copy is not equal to the original")
+	}
+
+	copied.Function.(*Identifier).Value = "g"
+	copied.Arguments[0].(*MapLiteral).Pairs[0].Value.(*IntegerLiteral).Value = 2
+
+	if original.Function.(*Identifier).Value != "f" {
+		t.Errorf("modifying the copy changed the original function")
+	}
+
+	if original.Arguments[0].(*MapLiteral).Pairs[0].Value.(*IntegerLiteral).Value != 1 {
+		t.Errorf("modifying the copy changed the original map value")
+	}
+}
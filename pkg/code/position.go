@@ -0,0 +1,29 @@
+package code
+
+import (
+	"sort"
+
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+// PositionEntry says that the instructions from Offset onwards were compiled
+// from source at Pos, up to the next entry.
+type PositionEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PositionTable maps instruction offsets back to source positions. Entries
+// are sorted by offset.
+type PositionTable []PositionEntry
+
+// Lookup returns the source position of the instruction at offset, or an
+// invalid position if the table has none.
+func (pt PositionTable) Lookup(offset int) token.Position {
+	idx := sort.Search(len(pt), func(i int) bool { return pt[i].Offset > offset })
+	if idx == 0 {
+		return token.Position{}
+	}
+
+	return pt[idx-1].Pos
+}
@@ -0,0 +1,64 @@
+package compiler
+
+import "github.com/estevesnp/dsb/pkg/ast"
+
+// Closures capture the locals they refer to by sharing a cell with the
+// function that defines them, so like in the evaluator they see the local
+// change when it's bound again, and can refer to locals defined after them,
+// as long as they only run once those are. Before its let, the function
+// itself still refers to the name's outer binding.
+
+// cellNames returns the locals of fn that closures inside it capture: its
+// parameters and lets, in the order they are defined, that any nested
+// function mentions. That may be a local the function doesn't use, which is
+// harmless.
+func cellNames(fn *ast.FunctionLiteral) []string {
+	mentioned := map[string]bool{}
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		if node, ok := node.(*ast.FunctionLiteral); ok {
+			ast.Inspect(node, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok {
+					mentioned[ident.Value] = true
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+
+	var names []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		if mentioned[name] && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for _, p := range fn.Parameters {
+		add(p.Value)
+	}
+
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				add(node.Name.Value)
+			}
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.CallExpression:
+			// code inside quote is data
+			return !isCallTo(node, "quote")
+		}
+		return true
+	})
+
+	return names
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
@@ -0,0 +1,604 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLessThan,
+	">":  code.OpGreaterThan,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+	"in": code.OpIn,
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.PositionTable
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the node being compiled, recorded for every
+	// instruction emitted
+	pos token.Position
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.PositionTable
+	Constants    []object.Object
+	// Globals names every global slot, so the VM can report which
+	// identifier was used before it was defined.
+	Globals []string
+	// Builtins names the builtins the program was compiled against, by
+	// index, so it's not run with a runtime whose builtins differ.
+	Builtins []string
+}
+
+func New() *Compiler {
+	symbolTable := NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
+	return NewWithState(symbolTable, []object.Object{})
+}
+
+// NewWithState returns a compiler that keeps defining globals in
+// symbolTable and appending to constants, so several programs can share
+// one set of globals.
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{{instructions: code.Instructions{}}},
+		scopeIndex:  0,
+	}
+}
+
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Global().Names(),
+		Builtins:     c.symbolTable.BuiltinNames(),
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if pos := ast.Pos(node); pos.IsValid() {
+		outer := c.pos
+		c.pos = pos
+		defer func() { c.pos = outer }()
+	}
+
+	switch node := node.(type) {
+
+	// Statements
+
+	case *ast.Program:
+		for i, stmt := range node.Statements {
+			if i < len(node.Statements)-1 {
+				if err := c.compileStatement(stmt); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// the program's value is the value of its last statement
+			if err := c.compileStatementValue(stmt); err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+		}
+
+	case *ast.BlockStatement:
+		return c.compileBlockValue(node)
+
+	case ast.Statement:
+		return c.compileStatement(node)
+
+	// Expressions
+
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+
+	case *ast.IntegerLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.SetLiteral:
+		if err := c.compileExpressions(node.Elements); err != nil {
+			return err
+		}
+		c.emit(code.OpSetLiteral, len(node.Elements))
+
+	case *ast.MapLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpMap, len(node.Pairs)*2)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unkown operator: %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("unkown operator: %s", node.Operator)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.MemberExpression:
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+		name := c.addConstant(&object.String{Value: node.Property.Value})
+		c.emit(code.OpMember, name)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			// not defined yet, so it can only be a global defined later
+			// on, or an error the VM reports when it is read
+			symbol = c.symbolTable.Global().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.MacroLiteral:
+		// macros are defined and expanded before compiling
+		c.emit(code.OpNull)
+
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+
+	default:
+		return fmt.Errorf("cannot compile node of type %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileStatement(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+
+	case *ast.ExpressionStatement:
+		if stmt.Expression == nil {
+			return nil
+		}
+		if err := c.Compile(stmt.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.LetStatement:
+		_, err := c.compileLetStatement(stmt)
+		return err
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(stmt.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BlockStatement:
+		for _, s := range stmt.Statements {
+			if err := c.compileStatement(s); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cannot compile statement of type %T", stmt)
+	}
+
+	return nil
+}
+
+// compileStatementValue compiles stmt leaving its value on the stack, which
+// for a let statement is the value it binds.
+func (c *Compiler) compileStatementValue(stmt ast.Statement) error {
+	switch stmt := stmt.(type) {
+
+	case *ast.ExpressionStatement:
+		if stmt.Expression == nil {
+			c.emit(code.OpNull)
+			return nil
+		}
+		return c.Compile(stmt.Expression)
+
+	case *ast.LetStatement:
+		symbol, err := c.compileLetStatement(stmt)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(symbol)
+		return nil
+
+	case *ast.BlockStatement:
+		return c.compileBlockValue(stmt)
+
+	default:
+		return c.compileStatement(stmt)
+	}
+}
+
+// compileBlockValue compiles a block leaving the value of its last statement
+// on the stack, or null when it is empty.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if block == nil || len(block.Statements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+
+	last := len(block.Statements) - 1
+	for _, stmt := range block.Statements[:last] {
+		if err := c.compileStatement(stmt); err != nil {
+			return err
+		}
+	}
+
+	return c.compileStatementValue(block.Statements[last])
+}
+
+func (c *Compiler) compileLetStatement(stmt *ast.LetStatement) (Symbol, error) {
+	var err error
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		err = c.compileFunction(fn, stmt.Name.Value)
+	} else {
+		err = c.Compile(stmt.Value)
+	}
+
+	if err != nil {
+		return Symbol{}, err
+	}
+
+	symbol := c.symbolTable.Define(stmt.Name.Value)
+	switch {
+	case symbol.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case symbol.Cell:
+		c.emit(code.OpSetCell, symbol.Index)
+	default:
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+
+	return symbol, nil
+}
+
+func (c *Compiler) compileExpressions(exps []ast.Expression) error {
+	for _, exp := range exps {
+		if err := c.Compile(exp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	if name != "" {
+		c.symbolTable.DefineFunctionName(name)
+	}
+
+	for _, p := range node.Parameters {
+		c.symbolTable.DefineParameter(p.Value)
+	}
+
+	for _, name := range cellNames(node) {
+		cell := c.symbolTable.DefineCell(name)
+		c.emit(code.OpBoxLocal, cell.Index, c.addConstant(&object.String{Value: name}))
+	}
+
+	if err := c.compileBlockValue(node.Body); err != nil {
+		return err
+	}
+
+	c.emit(code.OpReturnValue)
+	markTailCalls(c.currentInstructions())
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		Positions:     positions,
+		Source:        node,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	return nil
+}
+
+// markTailCalls turns the calls in ins whose result the function returns
+// right away into tail calls, which the VM runs in the caller's frame, so
+// recursion in tail position doesn't grow the stack, like in the evaluator.
+// The instructions after a tail call are kept, they run if the callee isn't
+// a closure.
+func markTailCalls(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+
+		_, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+
+		i = next
+	}
+}
+
+// returnsAt reports whether the instruction at i returns, or jumps ahead to
+// an instruction that does.
+func returnsAt(ins code.Instructions, i int) bool {
+	for i < len(ins) {
+		switch code.Opcode(ins[i]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			target := int(code.ReadUint16(ins[i+1:]))
+			if target <= i {
+				return false
+			}
+			i = target
+		default:
+			return false
+		}
+	}
+
+	return false
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	switch node.Function.TokenLiteral() {
+	case "quote":
+		return c.compileQuote(node)
+	}
+
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+
+	if err := c.compileExpressions(node.Arguments); err != nil {
+		return err
+	}
+
+	c.emit(code.OpCall, len(node.Arguments))
+
+	return nil
+}
+
+// compileQuote compiles the arguments of the unquote calls inside a quote,
+// in the order object.Unquote asks for them, so the VM can hand their values
+// back to it when building the quoted node.
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	if n := len(node.Arguments); n != 1 {
+		return fmt.Errorf("wrong number of arguments: expected 1, got %d", n)
+	}
+
+	template := node.Arguments[0]
+
+	var unquoted []ast.Node
+	_, err := object.Unquote(ast.Copy(template), func(arg ast.Node) object.Object {
+		unquoted = append(unquoted, arg)
+		return &object.Array{}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range unquoted {
+		if err := c.Compile(arg); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpQuote, c.addConstant(&object.Quote{Node: template}), len(unquoted))
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		if s.Cell {
+			c.emit(code.OpGetCell, s.Index)
+		} else {
+			c.emit(code.OpGetLocal, s.Index)
+		}
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// captureSymbol loads what a closure captures for s, the cell itself if s
+// lives in one.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFreeCell, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	return c.addInstruction(ins)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.positions); c.pos.IsValid() && (n == 0 || scope.positions[n-1].Pos != c.pos) {
+		scope.positions = append(scope.positions, code.PositionEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	copy(c.currentInstructions()[opPos:], newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex += 1
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex -= 1
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
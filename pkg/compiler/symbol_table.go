@@ -0,0 +1,214 @@
+package compiler
+
+import "slices"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	// Cell is set for the locals closures capture, which the VM keeps in
+	// an object.Cell.
+	Cell bool
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// builtins names the builtins defined in this table, by index, even
+	// those shadowed by other definitions since.
+	builtins []string
+
+	// unbound holds the cells defined ahead of their let, which isn't
+	// compiled yet. Until it is, the function refers to the name's outer
+	// binding, like the evaluator does before the let runs, while closures
+	// inside it already refer to the cell. outer holds the symbols for
+	// those outer bindings.
+	unbound map[string]bool
+	outer   map[string]Symbol
+
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this table. Defining a name twice in the same scope
+// reuses its slot, so closures that refer to it see the new value, just like
+// they do in the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	delete(s.unbound, name)
+
+	scope := GlobalScope
+	if s.Outer != nil {
+		scope = LocalScope
+	}
+
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions += 1
+
+	return symbol
+}
+
+// DefineParameter binds a function's parameter to a new slot, even if an
+// earlier parameter has the same name, which the last one then shadows like
+// in the evaluator.
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: LocalScope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions += 1
+
+	return symbol
+}
+
+// DefineCell is Define for a local that closures capture. If it isn't a
+// parameter, it's unbound until Define is called for it.
+func (s *SymbolTable) DefineCell(name string) Symbol {
+	existing, ok := s.store[name]
+	parameter := ok && existing.Scope == LocalScope
+
+	symbol := s.Define(name)
+	symbol.Cell = true
+	s.store[name] = symbol
+
+	if !parameter {
+		if s.unbound == nil {
+			s.unbound, s.outer = map[string]bool{}, map[string]Symbol{}
+		}
+		s.unbound[name] = true
+	}
+
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BuiltinScope, Index: index}
+	s.store[name] = symbol
+
+	if index >= len(s.builtins) {
+		s.builtins = append(s.builtins, make([]string, index+1-len(s.builtins))...)
+	}
+	s.builtins[index] = name
+
+	return symbol
+}
+
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FunctionScope, Index: 0}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
+
+// Resolve returns the symbol name refers to in this table's function.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	if !s.unbound[name] {
+		return s.resolve(name)
+	}
+
+	if symbol, ok := s.outer[name]; ok {
+		return symbol, ok
+	}
+
+	cell := s.store[name]
+	symbol, ok := s.resolveOuter(name)
+	// defineFree replaces the cell, which Define and closures still need
+	s.store[name] = cell
+
+	if ok {
+		s.outer[name] = symbol
+	}
+
+	return symbol, ok
+}
+
+// resolve is Resolve, without going around unbound cells, which closures
+// refer to.
+func (s *SymbolTable) resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	return s.resolveOuter(name)
+}
+
+// resolveOuter resolves name in the enclosing tables, capturing it as a free
+// variable if it's local to one of them.
+func (s *SymbolTable) resolveOuter(name string) (Symbol, bool) {
+	if s.Outer == nil {
+		return Symbol{}, false
+	}
+
+	symbol, ok := s.Outer.resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Global returns the outermost table, which holds the globals.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+
+	return s
+}
+
+// BuiltinNames returns the names of the builtins defined in the outermost
+// table, indexed by the index code refers to them with.
+func (s *SymbolTable) BuiltinNames() []string {
+	return slices.Clone(s.Global().builtins)
+}
+
+// Names returns the names of the symbols defined in this table, indexed by
+// their slot.
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index] = name
+		}
+	}
+
+	return names
+}
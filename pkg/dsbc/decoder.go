@@ -0,0 +1,370 @@
+package dsbc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+// decoder mirrors encoder. The first error it runs into is kept in err and
+// every read after that returns a zero value, so callers only need to check
+// err once they're done.
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) bytecode() *compiler.Bytecode {
+	bytecode := &compiler.Bytecode{
+		Instructions: d.bytes(),
+		Positions:    d.positions(),
+	}
+
+	numGlobals := d.uint()
+	for i := 0; i < numGlobals && d.err == nil; i++ {
+		bytecode.Globals = append(bytecode.Globals, d.string())
+	}
+
+	numBuiltins := d.uint()
+	if numBuiltins > object.MaxBuiltins {
+		d.fail(fmt.Errorf("%d builtins, more than a runtime can have", numBuiltins))
+	}
+	for i := 0; i < numBuiltins && d.err == nil; i++ {
+		bytecode.Builtins = append(bytecode.Builtins, d.string())
+	}
+
+	numConstants := d.uint()
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, d.constant())
+	}
+
+	if d.err == nil && d.r.Len() != 0 {
+		d.fail(fmt.Errorf("%d unexpected trailing bytes", d.r.Len()))
+	}
+
+	return bytecode
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+
+	case constInteger:
+		return &object.Integer{Value: d.int()}
+
+	case constFloat:
+		return &object.Float{Value: d.float()}
+
+	case constString:
+		return &object.String{Value: d.string()}
+
+	case constFunction:
+		fn := &object.CompiledFunction{
+			Instructions:  d.bytes(),
+			Positions:     d.positions(),
+			NumLocals:     d.uint(),
+			NumParameters: d.uint(),
+			Name:          d.string(),
+		}
+		if source, ok := d.node().(*ast.FunctionLiteral); ok {
+			fn.Source = source
+		}
+		return fn
+
+	case constQuote:
+		return &object.Quote{Node: d.node()}
+
+	default:
+		d.fail(fmt.Errorf("unknown constant tag %d", tag))
+		return nil
+	}
+}
+
+func (d *decoder) positions() code.PositionTable {
+	n := d.uint()
+	if n == 0 {
+		return nil
+	}
+
+	table := make(code.PositionTable, 0, min(n, d.r.Len()))
+	for i := 0; i < n && d.err == nil; i++ {
+		table = append(table, code.PositionEntry{Offset: d.uint(), Pos: d.position()})
+	}
+
+	return table
+}
+
+func (d *decoder) position() token.Position {
+	return token.Position{Line: d.uint(), Column: d.uint()}
+}
+
+func (d *decoder) token() token.Token {
+	return token.Token{
+		Type:    token.TokenType(d.string()),
+		Literal: d.string(),
+		Pos:     d.position(),
+	}
+}
+
+func (d *decoder) node() ast.Node {
+	switch tag := d.byte(); tag {
+
+	case nodeNil:
+		return nil
+
+	case nodeProgram:
+		return &ast.Program{Statements: d.statements()}
+
+	case nodeLetStatement:
+		return &ast.LetStatement{Token: d.token(), Name: d.identifier(), Value: d.expression()}
+
+	case nodeReturnStatement:
+		return &ast.ReturnStatement{Token: d.token(), ReturnValue: d.expression()}
+
+	case nodeExpressionStatement:
+		return &ast.ExpressionStatement{Token: d.token(), Expression: d.expression()}
+
+	case nodeBlockStatement:
+		return &ast.BlockStatement{Token: d.token(), Statements: d.statements()}
+
+	case nodeIdentifier:
+		return &ast.Identifier{Token: d.token(), Value: d.string()}
+
+	case nodeNullLiteral:
+		return &ast.NullLiteral{Token: d.token()}
+
+	case nodeIntegerLiteral:
+		return &ast.IntegerLiteral{Token: d.token(), Value: d.int()}
+
+	case nodeFloatLiteral:
+		return &ast.FloatLiteral{Token: d.token(), Value: d.float()}
+
+	case nodeStringLiteral:
+		return &ast.StringLiteral{Token: d.token(), Value: d.string()}
+
+	case nodeBoolean:
+		return &ast.Boolean{Token: d.token(), Value: d.bool()}
+
+	case nodeArrayLiteral:
+		return &ast.ArrayLiteral{Token: d.token(), Elements: d.expressions()}
+
+	case nodeSetLiteral:
+		return &ast.SetLiteral{Token: d.token(), Elements: d.expressions()}
+
+	case nodeMapLiteral:
+		m := &ast.MapLiteral{Token: d.token()}
+		n := d.uint()
+		for i := 0; i < n && d.err == nil; i++ {
+			m.Pairs = append(m.Pairs, &ast.MapPair{Key: d.expression(), Value: d.expression()})
+		}
+		return m
+
+	case nodePrefixExpression:
+		return &ast.PrefixExpression{Token: d.token(), Operator: d.string(), Right: d.expression()}
+
+	case nodeInfixExpression:
+		return &ast.InfixExpression{Token: d.token(), Left: d.expression(), Operator: d.string(), Right: d.expression()}
+
+	case nodeIndexExpression:
+		return &ast.IndexExpression{Token: d.token(), Left: d.expression(), Index: d.expression()}
+
+	case nodeMemberExpression:
+		return &ast.MemberExpression{Token: d.token(), Object: d.expression(), Property: d.identifier()}
+
+	case nodeIfExpression:
+		return &ast.IfExpression{Token: d.token(), Condition: d.expression(), Consequence: d.block(), Alternative: d.block()}
+
+	case nodeFunctionLiteral:
+		return &ast.FunctionLiteral{Token: d.token(), Parameters: d.identifiers(), Body: d.block()}
+
+	case nodeMacroLiteral:
+		return &ast.MacroLiteral{Token: d.token(), Parameters: d.identifiers(), Body: d.block()}
+
+	case nodeCallExpression:
+		return &ast.CallExpression{Token: d.token(), Function: d.expression(), Arguments: d.expressions()}
+
+	default:
+		d.fail(fmt.Errorf("unknown node tag %d", tag))
+		return nil
+	}
+}
+
+func (d *decoder) statements() []ast.Statement {
+	n := d.uint()
+	var stmts []ast.Statement
+	for i := 0; i < n && d.err == nil; i++ {
+		node := d.node()
+		stmt, ok := node.(ast.Statement)
+		if !ok {
+			d.fail(fmt.Errorf("expected a statement, got %T", node))
+			return nil
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
+
+func (d *decoder) expressions() []ast.Expression {
+	n := d.uint()
+	var exps []ast.Expression
+	for i := 0; i < n && d.err == nil; i++ {
+		exps = append(exps, d.expression())
+	}
+
+	return exps
+}
+
+func (d *decoder) expression() ast.Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		d.fail(fmt.Errorf("expected an expression, got %T", node))
+		return nil
+	}
+
+	return exp
+}
+
+func (d *decoder) block() *ast.BlockStatement {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	block, ok := node.(*ast.BlockStatement)
+	if !ok {
+		d.fail(fmt.Errorf("expected a block, got %T", node))
+		return nil
+	}
+
+	return block
+}
+
+func (d *decoder) identifiers() []*ast.Identifier {
+	n := d.uint()
+	var idents []*ast.Identifier
+	for i := 0; i < n && d.err == nil; i++ {
+		idents = append(idents, d.identifier())
+	}
+
+	return idents
+}
+
+func (d *decoder) identifier() *ast.Identifier {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	ident, ok := node.(*ast.Identifier)
+	if !ok {
+		d.fail(fmt.Errorf("expected an identifier, got %T", node))
+		return nil
+	}
+
+	return ident
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		d.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	return b
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	if n > math.MaxInt32 {
+		d.fail(fmt.Errorf("value %d out of range", n))
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	n, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	return n
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[:]); err != nil {
+		d.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+
+	return math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint()
+	if d.err != nil {
+		return nil
+	}
+
+	if n > d.r.Len() {
+		d.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+
+	b := make([]byte, n)
+	d.r.Read(b)
+
+	return b
+}
@@ -0,0 +1,117 @@
+// Package dsbc reads and writes compiled programs, so they can be run
+// without lexing, parsing or compiling them again.
+//
+// A file starts with the magic bytes "DSBC" and a format version, followed
+// by the length of the payload, the payload itself and a CRC-32 checksum of
+// the payload. The payload holds the program's instructions, its position
+// table, the names of its globals and of the builtins it was compiled
+// against, and its constants. Read checks the instructions before returning
+// them, so an edited file is an error rather than a crash in the VM.
+package dsbc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/estevesnp/dsb/pkg/compiler"
+)
+
+// Version is the format version written to new files. It must be bumped
+// whenever the encoding or the instruction set changes in a way older files
+// can't be run with. Changes to the builtins don't need it, since files name
+// the builtins they were compiled against.
+const Version uint16 = 4
+
+// Extension is the file extension for compiled programs.
+const Extension = ".dsbc"
+
+var magic = [4]byte{'D', 'S', 'B', 'C'}
+
+var (
+	ErrBadMagic = errors.New("not a compiled dsb program")
+	ErrChecksum = errors.New("compiled program is corrupted: checksum mismatch")
+)
+
+type VersionError struct {
+	Got  uint16
+	Want uint16
+}
+
+func (ve *VersionError) Error() string {
+	return fmt.Sprintf("compiled program has format version %d, this dsb reads version %d, rebuild it", ve.Got, ve.Want)
+}
+
+type header struct {
+	Magic   [4]byte
+	Version uint16
+	Length  uint32
+}
+
+func Write(w io.Writer, bytecode *compiler.Bytecode) error {
+	enc := &encoder{}
+	if err := enc.bytecode(bytecode); err != nil {
+		return err
+	}
+
+	payload := enc.buf.Bytes()
+
+	h := header{Magic: magic, Version: Version, Length: uint32(len(payload))}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, crc32.ChecksumIEEE(payload))
+}
+
+func Read(r io.Reader) (*compiler.Bytecode, error) {
+	var h header
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrBadMagic
+		}
+		return nil, err
+	}
+
+	if h.Magic != magic {
+		return nil, ErrBadMagic
+	}
+
+	if h.Version != Version {
+		return nil, &VersionError{Got: h.Version, Want: Version}
+	}
+
+	// the length is only trusted as far as the file backs it up
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, io.LimitReader(r, int64(h.Length))); err != nil || n != int64(h.Length) {
+		return nil, ErrChecksum
+	}
+	payload := buf.Bytes()
+
+	var checksum uint32
+	if err := binary.Read(r, binary.BigEndian, &checksum); err != nil {
+		return nil, ErrChecksum
+	}
+
+	if checksum != crc32.ChecksumIEEE(payload) {
+		return nil, ErrChecksum
+	}
+
+	dec := &decoder{r: bytes.NewReader(payload)}
+	bytecode := dec.bytecode()
+	if dec.err == nil {
+		dec.err = validate(bytecode)
+	}
+	if dec.err != nil {
+		return nil, fmt.Errorf("malformed compiled program: %w", dec.err)
+	}
+
+	return bytecode, nil
+}
@@ -0,0 +1,210 @@
+package dsbc
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/interpreter"
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let add = fn(a) { fn(b) { a + b } }; add(2)(3)", "5"},
+		{`let m = {"a": [1, "two"], "b": {3}}; m.a[1] + "!"`, "two!"},
+		{"let double = macro(x) { quote(unquote(x) * 2) }; double(4)", "8"},
+		{"let x = 3; quote(unquote(x) + y)", "QUOTE((3 + y))"},
+		{"let half = fn(x) { x * 0.5 }; half(5)", "2.5"},
+		{"quote(1.25 + unquote(0.5 * 3))", "QUOTE((1.25 + 1.5))"},
+		{"let f = fn(x) { if (x > 1) { x } else { -x } }; quote(unquote(f))", "QUOTE(fn(x) if(x > 1) xelse (-x))"},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, tt.input)
+
+		res, err := interpreter.New().RunBytecode(roundTrip(t, bytecode))
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.input, err)
+		}
+
+		if res.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. want %q, got %q", tt.input, tt.expected, res.Inspect())
+		}
+	}
+}
+
+func TestRoundTripKeepsPositions(t *testing.T) {
+	bytecode := compile(t, "let f = fn(a) {\n  a + true\n};\nf(1)")
+
+	_, err := interpreter.New().RunBytecode(roundTrip(t, bytecode))
+
+	var evalErr *interpreter.EvalError
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("expected *interpreter.EvalError, got %T (%v)", err, err)
+	}
+
+	if evalErr.Pos.String() != "2:3" {
+		t.Errorf("wrong error position. want %q, got %q", "2:3", evalErr.Pos.String())
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, compile(t, `let s = "hello"; len(s)`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := buf.Bytes()
+
+	corrupt := func(i int, b byte) []byte {
+		c := bytes.Clone(data)
+		c[i] = b
+		return c
+	}
+
+	_, err := Read(bytes.NewReader(corrupt(0, 'X')))
+	if !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+
+	_, err = Read(bytes.NewReader([]byte("let")))
+	if !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected ErrBadMagic for a short file, got %v", err)
+	}
+
+	_, err = Read(bytes.NewReader(corrupt(5, byte(Version+1))))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("expected *VersionError, got %T (%v)", err, err)
+	}
+	if versionErr.Got != Version+1 || versionErr.Want != Version {
+		t.Errorf("wrong versions in error, got %+v", versionErr)
+	}
+
+	_, err = Read(bytes.NewReader(corrupt(len(data)-6, data[len(data)-6]^0xff)))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum for a flipped byte, got %v", err)
+	}
+
+	_, err = Read(bytes.NewReader(data[:len(data)-2]))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum for a truncated file, got %v", err)
+	}
+}
+
+func TestReadTrustsLengthOnlyAsFarAsTheFile(t *testing.T) {
+	data := append([]byte("DSBC"), 0, byte(Version), 0xff, 0xff, 0xff, 0xff)
+
+	_, err := Read(bytes.NewReader(data))
+	if !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum for a length past the end of the file, got %v", err)
+	}
+}
+
+func TestReadValidatesInstructions(t *testing.T) {
+	tests := []struct {
+		instructions [][]byte
+		expected     string
+	}{
+		{[][]byte{code.Make(code.OpConstant, 500)}, "constant 500 out of range"},
+		{[][]byte{{200}}, "opcode 200 undefined"},
+		{[][]byte{code.Make(code.OpConstant, 0)[:2]}, "OpConstant is missing its operands"},
+		{[][]byte{code.Make(code.OpGetGlobal, 3)}, "global 3 out of range"},
+		{[][]byte{code.Make(code.OpGetBuiltin, 250)}, "builtin 250 out of range"},
+		{[][]byte{code.Make(code.OpGetLocal, 0)}, "local 0 out of range"},
+		{[][]byte{code.Make(code.OpGetFree, 0)}, "free variable 0 out of range"},
+		{[][]byte{code.Make(code.OpPop)}, "pops 1 values off a stack of 0"},
+		{[][]byte{code.Make(code.OpJump, 1)}, "jump to 1, which isn't the start of an instruction"},
+		{[][]byte{code.Make(code.OpMember, 0)}, "constant 0 isn't a string"},
+		{[][]byte{code.Make(code.OpClosure, 0, 0)}, "constant 0 isn't a function"},
+		{[][]byte{code.Make(code.OpConstant, 0), code.Make(code.OpCall, 3)}, "pops 4 values off a stack of 1"},
+	}
+
+	for _, tt := range tests {
+		bytecode := compile(t, "1")
+		bytecode.Instructions = bytes.Join(tt.instructions, nil)
+		bytecode.Positions = nil
+
+		var buf bytes.Buffer
+		if err := Write(&buf, bytecode); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		_, err := Read(&buf)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %v. want one containing %q, got %v", tt.instructions, tt.expected, err)
+		}
+	}
+}
+
+func TestBuiltinsMustMatch(t *testing.T) {
+	interp := interpreter.New()
+	if err := interp.Runtime().RegisterFunc("double", func(n int) int { return n * 2 }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bytecode, err := interp.Compile("double(len([1, 2]))")
+	if err != nil {
+		t.Fatalf("compile error: %v", err)
+	}
+	bytecode = roundTrip(t, bytecode)
+
+	res, err := interp.RunBytecode(bytecode)
+	if err != nil || res.Inspect() != "4" {
+		t.Fatalf("wrong result with the same builtins. got %v, %v", res, err)
+	}
+
+	_, err = interpreter.New().RunBytecode(bytecode)
+	if err == nil || !strings.Contains(err.Error(), "rebuild it") {
+		t.Errorf("expected an error for a runtime missing a builtin, got %v", err)
+	}
+
+	renamed := roundTrip(t, bytecode)
+	renamed.Builtins[0] = "nope"
+
+	_, err = interp.RunBytecode(renamed)
+	if err == nil || !strings.Contains(err.Error(), "expects builtin 0 to be nope") {
+		t.Errorf("expected an error for a different builtin, got %v", err)
+	}
+}
+
+func TestWriteUnsupportedConstant(t *testing.T) {
+	bytecode := &compiler.Bytecode{Constants: []object.Object{object.TRUE}}
+
+	if err := Write(&bytes.Buffer{}, bytecode); err == nil {
+		t.Errorf("expected an error for a boolean constant")
+	}
+}
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	bytecode, err := interpreter.New().Compile(input)
+	if err != nil {
+		t.Fatalf("compile error for %q: %v", input, err)
+	}
+
+	return bytecode
+}
+
+func roundTrip(t *testing.T, bytecode *compiler.Bytecode) *compiler.Bytecode {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, bytecode); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+
+	return read
+}
@@ -0,0 +1,335 @@
+package dsbc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+const (
+	constInteger byte = iota + 1
+	constString
+	constFunction
+	constQuote
+	constFloat
+)
+
+const (
+	nodeNil byte = iota
+	nodeProgram
+	nodeLetStatement
+	nodeReturnStatement
+	nodeExpressionStatement
+	nodeBlockStatement
+	nodeIdentifier
+	nodeNullLiteral
+	nodeIntegerLiteral
+	nodeStringLiteral
+	nodeBoolean
+	nodeArrayLiteral
+	nodeSetLiteral
+	nodeMapLiteral
+	nodePrefixExpression
+	nodeInfixExpression
+	nodeIndexExpression
+	nodeMemberExpression
+	nodeIfExpression
+	nodeFunctionLiteral
+	nodeMacroLiteral
+	nodeCallExpression
+	nodeFloatLiteral
+)
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) bytecode(bytecode *compiler.Bytecode) error {
+	e.bytes(bytecode.Instructions)
+	e.positions(bytecode.Positions)
+
+	e.uint(len(bytecode.Globals))
+	for _, name := range bytecode.Globals {
+		e.string(name)
+	}
+
+	e.uint(len(bytecode.Builtins))
+	for _, name := range bytecode.Builtins {
+		e.string(name)
+	}
+
+	e.uint(len(bytecode.Constants))
+	for _, constant := range bytecode.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+
+	case *object.Integer:
+		e.buf.WriteByte(constInteger)
+		e.int(obj.Value)
+
+	case *object.Float:
+		e.buf.WriteByte(constFloat)
+		e.float(obj.Value)
+
+	case *object.String:
+		e.buf.WriteByte(constString)
+		e.string(obj.Value)
+
+	case *object.CompiledFunction:
+		e.buf.WriteByte(constFunction)
+		e.bytes(obj.Instructions)
+		e.positions(obj.Positions)
+		e.uint(obj.NumLocals)
+		e.uint(obj.NumParameters)
+		e.string(obj.Name)
+		if obj.Source == nil {
+			e.node(nil)
+		} else {
+			e.node(obj.Source)
+		}
+
+	case *object.Quote:
+		e.buf.WriteByte(constQuote)
+		e.node(obj.Node)
+
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+
+	return nil
+}
+
+func (e *encoder) positions(table code.PositionTable) {
+	e.uint(len(table))
+	for _, entry := range table {
+		e.uint(entry.Offset)
+		e.position(entry.Pos)
+	}
+}
+
+func (e *encoder) position(pos token.Position) {
+	e.uint(pos.Line)
+	e.uint(pos.Column)
+}
+
+func (e *encoder) token(tok token.Token) {
+	e.string(string(tok.Type))
+	e.string(tok.Literal)
+	e.position(tok.Pos)
+}
+
+func (e *encoder) node(node ast.Node) {
+	switch node := node.(type) {
+
+	case nil:
+		e.buf.WriteByte(nodeNil)
+
+	case *ast.Program:
+		e.buf.WriteByte(nodeProgram)
+		e.statements(node.Statements)
+
+	case *ast.LetStatement:
+		e.buf.WriteByte(nodeLetStatement)
+		e.token(node.Token)
+		e.identifier(node.Name)
+		e.expression(node.Value)
+
+	case *ast.ReturnStatement:
+		e.buf.WriteByte(nodeReturnStatement)
+		e.token(node.Token)
+		e.expression(node.ReturnValue)
+
+	case *ast.ExpressionStatement:
+		e.buf.WriteByte(nodeExpressionStatement)
+		e.token(node.Token)
+		e.expression(node.Expression)
+
+	case *ast.BlockStatement:
+		if node == nil {
+			e.buf.WriteByte(nodeNil)
+			return
+		}
+		e.buf.WriteByte(nodeBlockStatement)
+		e.token(node.Token)
+		e.statements(node.Statements)
+
+	case *ast.Identifier:
+		if node == nil {
+			e.buf.WriteByte(nodeNil)
+			return
+		}
+		e.buf.WriteByte(nodeIdentifier)
+		e.token(node.Token)
+		e.string(node.Value)
+
+	case *ast.NullLiteral:
+		e.buf.WriteByte(nodeNullLiteral)
+		e.token(node.Token)
+
+	case *ast.IntegerLiteral:
+		e.buf.WriteByte(nodeIntegerLiteral)
+		e.token(node.Token)
+		e.int(node.Value)
+
+	case *ast.FloatLiteral:
+		e.buf.WriteByte(nodeFloatLiteral)
+		e.token(node.Token)
+		e.float(node.Value)
+
+	case *ast.StringLiteral:
+		e.buf.WriteByte(nodeStringLiteral)
+		e.token(node.Token)
+		e.string(node.Value)
+
+	case *ast.Boolean:
+		e.buf.WriteByte(nodeBoolean)
+		e.token(node.Token)
+		e.bool(node.Value)
+
+	case *ast.ArrayLiteral:
+		e.buf.WriteByte(nodeArrayLiteral)
+		e.token(node.Token)
+		e.expressions(node.Elements)
+
+	case *ast.SetLiteral:
+		e.buf.WriteByte(nodeSetLiteral)
+		e.token(node.Token)
+		e.expressions(node.Elements)
+
+	case *ast.MapLiteral:
+		e.buf.WriteByte(nodeMapLiteral)
+		e.token(node.Token)
+		e.uint(len(node.Pairs))
+		for _, pair := range node.Pairs {
+			e.expression(pair.Key)
+			e.expression(pair.Value)
+		}
+
+	case *ast.PrefixExpression:
+		e.buf.WriteByte(nodePrefixExpression)
+		e.token(node.Token)
+		e.string(node.Operator)
+		e.expression(node.Right)
+
+	case *ast.InfixExpression:
+		e.buf.WriteByte(nodeInfixExpression)
+		e.token(node.Token)
+		e.expression(node.Left)
+		e.string(node.Operator)
+		e.expression(node.Right)
+
+	case *ast.IndexExpression:
+		e.buf.WriteByte(nodeIndexExpression)
+		e.token(node.Token)
+		e.expression(node.Left)
+		e.expression(node.Index)
+
+	case *ast.MemberExpression:
+		e.buf.WriteByte(nodeMemberExpression)
+		e.token(node.Token)
+		e.expression(node.Object)
+		e.identifier(node.Property)
+
+	case *ast.IfExpression:
+		e.buf.WriteByte(nodeIfExpression)
+		e.token(node.Token)
+		e.expression(node.Condition)
+		e.node(node.Consequence)
+		e.node(node.Alternative)
+
+	case *ast.FunctionLiteral:
+		e.buf.WriteByte(nodeFunctionLiteral)
+		e.token(node.Token)
+		e.identifiers(node.Parameters)
+		e.node(node.Body)
+
+	case *ast.MacroLiteral:
+		e.buf.WriteByte(nodeMacroLiteral)
+		e.token(node.Token)
+		e.identifiers(node.Parameters)
+		e.node(node.Body)
+
+	case *ast.CallExpression:
+		e.buf.WriteByte(nodeCallExpression)
+		e.token(node.Token)
+		e.expression(node.Function)
+		e.expressions(node.Arguments)
+
+	default:
+		panic(fmt.Sprintf("dsbc: cannot encode node of type %T", node))
+	}
+}
+
+func (e *encoder) statements(stmts []ast.Statement) {
+	e.uint(len(stmts))
+	for _, stmt := range stmts {
+		e.node(stmt)
+	}
+}
+
+func (e *encoder) expressions(exps []ast.Expression) {
+	e.uint(len(exps))
+	for _, exp := range exps {
+		e.expression(exp)
+	}
+}
+
+func (e *encoder) expression(exp ast.Expression) {
+	e.node(exp)
+}
+
+func (e *encoder) identifiers(idents []*ast.Identifier) {
+	e.uint(len(idents))
+	for _, ident := range idents {
+		e.identifier(ident)
+	}
+}
+
+func (e *encoder) identifier(ident *ast.Identifier) {
+	e.node(ident)
+}
+
+func (e *encoder) uint(n int) {
+	e.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *encoder) int(n int64) {
+	e.buf.Write(binary.AppendVarint(nil, n))
+}
+
+func (e *encoder) float(f float64) {
+	e.buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(len(b))
+	e.buf.Write(b)
+}
@@ -0,0 +1,370 @@
+package dsbc
+
+import (
+	"fmt"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+// validate checks that every instruction of bytecode can run on the VM
+// without reading past its operands, the constants, globals, builtins,
+// locals or free variables it has, or the bottom of its stack. The compiler
+// never produces code that does, but a file can be edited by hand.
+func validate(bytecode *compiler.Bytecode) error {
+	v := &validator{bytecode: bytecode, numFree: map[int]int{}}
+
+	// closures of a function can be made before or after it, by any code
+	v.collectFree(bytecode.Instructions)
+	for _, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			v.collectFree(fn.Instructions)
+		}
+	}
+
+	main := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	if err := v.function(main, 0, true); err != nil {
+		return fmt.Errorf("main program: %w", err)
+	}
+
+	for idx, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		if err := v.function(fn, v.numFree[idx], false); err != nil {
+			return fmt.Errorf("function %d: %w", idx, err)
+		}
+	}
+
+	return nil
+}
+
+type validator struct {
+	bytecode *compiler.Bytecode
+
+	// numFree holds the fewest free variables any closure of a function
+	// constant is made with, by its index
+	numFree map[int]int
+}
+
+// collectFree records how many free variables the closures made by ins
+// have, stopping at anything it can't decode, which function reports.
+func (v *validator) collectFree(ins code.Instructions) {
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return
+		}
+
+		width := operandsWidth(def)
+		if offset+1+width > len(ins) {
+			return
+		}
+
+		if code.Opcode(ins[offset]) == code.OpClosure {
+			operands, _ := code.ReadOperands(def, ins[offset+1:])
+			if n, ok := v.numFree[operands[0]]; !ok || operands[1] < n {
+				v.numFree[operands[0]] = operands[1]
+			}
+		}
+
+		offset += 1 + width
+	}
+}
+
+// instruction is a decoded instruction with the stack it needs and leaves.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	width    int
+	pops     int
+	pushes   int
+}
+
+func (v *validator) function(fn *object.CompiledFunction, numFree int, main bool) error {
+	if fn.NumParameters > fn.NumLocals {
+		return fmt.Errorf("%d parameters, but only %d locals", fn.NumParameters, fn.NumLocals)
+	}
+
+	ins := fn.Instructions
+	decoded := map[int]instruction{}
+	cells := map[int]bool{}
+	prologue := true
+
+	for offset := 0; offset < len(ins); {
+		def, err := code.Lookup(ins[offset])
+		if err != nil {
+			return fmt.Errorf("at %d: %w", offset, err)
+		}
+
+		width := operandsWidth(def)
+		if offset+1+width > len(ins) {
+			return fmt.Errorf("at %d: %s is missing its operands", offset, def.Name)
+		}
+
+		operands, _ := code.ReadOperands(def, ins[offset+1:])
+		in, err := v.instruction(code.Opcode(ins[offset]), operands, fn, numFree)
+		if err != nil {
+			return fmt.Errorf("at %d: %s: %w", offset, def.Name, err)
+		}
+
+		// cells are made before anything else runs, so the other
+		// instructions know which locals hold one
+		if in.op == code.OpBoxLocal {
+			if !prologue {
+				return fmt.Errorf("at %d: %s after the start of the function", offset, def.Name)
+			}
+			cells[operands[0]] = true
+		} else {
+			prologue = false
+		}
+
+		in.width = 1 + width
+		decoded[offset] = in
+		offset += 1 + width
+	}
+
+	for offset, in := range decoded {
+		switch in.op {
+		case code.OpGetCell, code.OpSetCell:
+			if !cells[in.operands[0]] {
+				return fmt.Errorf("at %d: local %d doesn't hold a cell", offset, in.operands[0])
+			}
+		case code.OpSetLocal:
+			if cells[in.operands[0]] {
+				return fmt.Errorf("at %d: local %d holds a cell", offset, in.operands[0])
+			}
+		}
+	}
+
+	return checkStack(decoded, len(ins), main)
+}
+
+// checkStack follows every path through the instructions, making sure none
+// pops more than was pushed, that paths meet with the same stack, and that
+// only the main program runs off the end of its instructions.
+func checkStack(decoded map[int]instruction, end int, main bool) error {
+	heights := map[int]int{}
+	var pending []int
+
+	reach := func(target, height int) error {
+		if target == end {
+			if !main {
+				return fmt.Errorf("runs off the end of the function")
+			}
+			return nil
+		}
+
+		if _, ok := decoded[target]; !ok {
+			return fmt.Errorf("jump to %d, which isn't the start of an instruction", target)
+		}
+
+		if seen, ok := heights[target]; ok {
+			if seen != height {
+				return fmt.Errorf("reaches %d with %d values on the stack and with %d", target, seen, height)
+			}
+			return nil
+		}
+
+		heights[target] = height
+		pending = append(pending, target)
+		return nil
+	}
+
+	if err := reach(0, 0); err != nil {
+		return err
+	}
+
+	for len(pending) > 0 {
+		offset := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		in := decoded[offset]
+		height := heights[offset]
+
+		if height < in.pops {
+			return fmt.Errorf("at %d: pops %d values off a stack of %d", offset, in.pops, height)
+		}
+		height += in.pushes - in.pops
+
+		next := offset + in.width
+
+		var err error
+		switch in.op {
+		case code.OpReturnValue:
+		case code.OpJump:
+			err = reach(in.operands[0], height)
+		case code.OpJumpNotTruthy:
+			if err = reach(in.operands[0], height); err == nil {
+				err = reach(next, height)
+			}
+		default:
+			err = reach(next, height)
+		}
+
+		if err != nil {
+			return fmt.Errorf("at %d: %w", offset, err)
+		}
+	}
+
+	return nil
+}
+
+// instruction checks the operands of op, returning it with its effect on
+// the stack.
+func (v *validator) instruction(op code.Opcode, operands []int, fn *object.CompiledFunction, numFree int) (instruction, error) {
+	in := instruction{op: op, operands: operands}
+
+	switch op {
+	case code.OpConstant:
+		in.pushes = 1
+		return in, v.constant(operands[0])
+
+	case code.OpPop, code.OpJumpNotTruthy, code.OpReturnValue:
+		in.pops = 1
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+		code.OpLessEqual, code.OpGreaterEqual, code.OpIn, code.OpIndex:
+		in.pops, in.pushes = 2, 1
+
+	case code.OpMinus, code.OpBang:
+		in.pops, in.pushes = 1, 1
+
+	case code.OpTrue, code.OpFalse, code.OpNull, code.OpCurrentClosure:
+		in.pushes = 1
+
+	case code.OpJump:
+
+	case code.OpGetGlobal, code.OpSetGlobal:
+		if operands[0] >= len(v.bytecode.Globals) {
+			return in, fmt.Errorf("global %d out of range, the program has %d", operands[0], len(v.bytecode.Globals))
+		}
+		if op == code.OpGetGlobal {
+			in.pushes = 1
+		} else {
+			in.pops = 1
+		}
+
+	case code.OpGetBuiltin:
+		if operands[0] >= len(v.bytecode.Builtins) {
+			return in, fmt.Errorf("builtin %d out of range, the program has %d", operands[0], len(v.bytecode.Builtins))
+		}
+		in.pushes = 1
+
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpBoxLocal:
+		if operands[0] >= fn.NumLocals {
+			return in, fmt.Errorf("local %d out of range, the function has %d", operands[0], fn.NumLocals)
+		}
+		switch op {
+		case code.OpGetLocal, code.OpGetCell:
+			in.pushes = 1
+		case code.OpSetLocal, code.OpSetCell:
+			in.pops = 1
+		case code.OpBoxLocal:
+			return in, v.constantOf(operands[1], "a string", isString)
+		}
+
+	case code.OpGetFree, code.OpGetFreeCell:
+		if operands[0] >= numFree {
+			return in, fmt.Errorf("free variable %d out of range, the closure has %d", operands[0], numFree)
+		}
+		in.pushes = 1
+
+	case code.OpArray, code.OpSetLiteral:
+		in.pops, in.pushes = operands[0], 1
+
+	case code.OpMap:
+		if operands[0]%2 != 0 {
+			return in, fmt.Errorf("odd number of keys and values %d", operands[0])
+		}
+		in.pops, in.pushes = operands[0], 1
+
+	case code.OpMember:
+		in.pops, in.pushes = 1, 1
+		return in, v.constantOf(operands[0], "a string", isString)
+
+	case code.OpCall, code.OpTailCall:
+		in.pops, in.pushes = operands[0]+1, 1
+
+	case code.OpClosure:
+		in.pops, in.pushes = operands[1], 1
+		if err := v.constantOf(operands[0], "a function", isFunction); err != nil {
+			return in, err
+		}
+
+	case code.OpQuote:
+		in.pops, in.pushes = operands[1], 1
+		if err := v.constantOf(operands[0], "a quote", isQuote); err != nil {
+			return in, err
+		}
+		if n := countUnquotes(v.bytecode.Constants[operands[0]].(*object.Quote)); n != operands[1] {
+			return in, fmt.Errorf("quote %d has %d unquotes, not %d", operands[0], n, operands[1])
+		}
+
+	default:
+		return in, fmt.Errorf("not run by the VM")
+	}
+
+	return in, nil
+}
+
+func (v *validator) constant(idx int) error {
+	if idx >= len(v.bytecode.Constants) {
+		return fmt.Errorf("constant %d out of range, the program has %d", idx, len(v.bytecode.Constants))
+	}
+
+	return nil
+}
+
+func (v *validator) constantOf(idx int, kind string, is func(object.Object) bool) error {
+	if err := v.constant(idx); err != nil {
+		return err
+	}
+
+	if !is(v.bytecode.Constants[idx]) {
+		return fmt.Errorf("constant %d isn't %s", idx, kind)
+	}
+
+	return nil
+}
+
+func operandsWidth(def *code.Definition) int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+
+	return width
+}
+
+func isString(obj object.Object) bool {
+	_, ok := obj.(*object.String)
+	return ok
+}
+
+func isFunction(obj object.Object) bool {
+	_, ok := obj.(*object.CompiledFunction)
+	return ok
+}
+
+func isQuote(obj object.Object) bool {
+	_, ok := obj.(*object.Quote)
+	return ok
+}
+
+// countUnquotes returns how many values the VM fills quote in with, the
+// same way the compiler counts them.
+func countUnquotes(quote *object.Quote) int {
+	n := 0
+	object.Unquote(ast.Copy(quote.Node), func(ast.Node) object.Object {
+		n += 1
+		return &object.Array{}
+	})
+
+	return n
+}
@@ -0,0 +1,129 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/parser"
+	"github.com/estevesnp/dsb/pkg/resolver"
+	"github.com/estevesnp/dsb/pkg/vm"
+)
+
+type backend string
+
+const (
+	evaluatorBackend backend = "evaluator"
+	resolvedBackend  backend = "resolved evaluator"
+	vmBackend        backend = "vm"
+)
+
+// testBackend is the backend testEval runs programs with. TestMain runs the
+// whole suite once per backend, so every test that goes through testEval
+// checks that the evaluator, with and without resolved slots, and the VM
+// agree.
+var testBackend = evaluatorBackend
+
+func TestMain(m *testing.M) {
+	for _, b := range []backend{evaluatorBackend, resolvedBackend, vmBackend} {
+		testBackend = b
+
+		if code := m.Run(); code != 0 {
+			fmt.Fprintf(os.Stderr, "tests failed with the %s backend\n", b)
+			os.Exit(code)
+		}
+	}
+
+	os.Exit(0)
+}
+
+func testEval(input string) object.Object {
+	program, macroEnv, err := testExpand(input)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	switch testBackend {
+	case vmBackend:
+		return testRun(program, macroEnv, nil)
+	case resolvedBackend:
+		resolver.New().Resolve(program.(*ast.Program))
+	}
+
+	env := object.NewEnclosedEnvironment(macroEnv)
+
+	return Eval(program, env)
+}
+
+// testEvalWithLimits is testEval for a run with lim.
+func testEvalWithLimits(input string, lim limits.Limits) object.Object {
+	program, macroEnv, err := testExpand(input)
+	if err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	switch testBackend {
+	case vmBackend:
+		return testRun(program, macroEnv, &lim)
+	case resolvedBackend:
+		resolver.New().Resolve(program.(*ast.Program))
+	}
+
+	env := object.NewEnclosedEnvironment(macroEnv)
+
+	return New(object.NewRuntime()).EvalContext(context.Background(), program, env, lim)
+}
+
+// testExpand parses input, defines its macros and expands them, like the
+// interpreter does before running a program on any backend.
+func testExpand(input string) (ast.Node, *object.Environment, error) {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+
+	return expanded, macroEnv, err
+}
+
+// testRun compiles and runs program on the VM, with lim if it's not nil,
+// turning compile and runtime errors into *object.Error values like the
+// evaluator returns. macroexpand expands with the macros in macroEnv.
+func testRun(program ast.Node, macroEnv *object.Environment, lim *limits.Limits) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	rt := object.NewRuntime()
+	rt.Expand = func(ctx context.Context, node ast.Node, all bool) (ast.Node, error) {
+		return New(rt).MacroExpand(node, macroEnv, all)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetRuntime(rt)
+	if lim != nil {
+		machine.SetLimits(context.Background(), *lim)
+	}
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+func skipOnVM(t *testing.T, reason string) {
+	t.Helper()
+
+	if testBackend == vmBackend {
+		t.Skip(reason)
+	}
+}
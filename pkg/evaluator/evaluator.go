@@ -4,55 +4,82 @@ import (
 	"fmt"
 
 	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/limits"
 	"github.com/estevesnp/dsb/pkg/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-
-	integerCache = map[int64]*object.Integer{}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
-var builtins = map[string]*object.Builtin{
-	"print":  {Fn: Print},
-	"typeOf": {Fn: TypeOf},
-	"len":    {Fn: Len},
-	"first":  {Fn: First},
-	"last":   {Fn: Last},
-	"tail":   {Fn: Tail},
-	"push":   {Fn: Push},
+// smallIntegers holds the integers from -128 to 128, which are used often
+// enough to share. It's filled once and only read after, so runs in
+// different goroutines can share it.
+var smallIntegers [257]*object.Integer
+
+func init() {
+	for i := range smallIntegers {
+		smallIntegers[i] = &object.Integer{Value: int64(i - 128)}
+	}
+}
+
+// Evaluator walks the AST of programs, calling the builtins of its Runtime.
+// It keeps the state of the program it's running, so it runs one program at
+// a time, but separate Evaluators can run at the same time.
+type Evaluator struct {
+	runtime *object.Runtime
+
+	// meter is nil unless the run was started by EvalContext
+	meter *limits.Meter
+	depth int
 }
 
+func New(runtime *object.Runtime) *Evaluator {
+	return &Evaluator{runtime: runtime}
+}
+
+// Eval evaluates node in env with a new Runtime.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New(object.NewRuntime()).Eval(node, env)
+}
+
+// Eval evaluates node in env, without limits.
+func (ev *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := ev.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 
 	// Statements
 
 	case *ast.Program:
-		return evalProgram(node.Statements, env)
+		return ev.evalProgram(node.Statements, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return ev.Eval(node.Expression, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		return ev.evalBlockStatement(node, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
+		val := ev.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
+		val := ev.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
-		return val
+		if binding := node.Name.Binding; binding != nil {
+			return env.SetAt(binding.Slot, node.Name.Value, val)
+		}
+		return env.Set(node.Name.Value, val)
 
 	// Expressions
 
@@ -62,98 +89,99 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IntegerLiteral:
 		return createInteger(node.Value)
 
+	case *ast.FloatLiteral:
+		return ev.track(&object.Float{Value: node.Value})
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return ev.track(&object.String{Value: node.Value})
 
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
+		elements := ev.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return ev.track(&object.Array{Elements: elements})
 
 	case *ast.MapLiteral:
-		return evalMapLiteral(node, env)
+		return ev.track(ev.evalMapLiteral(node, env))
+
+	case *ast.SetLiteral:
+		return ev.track(ev.evalSetLiteral(node, env))
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
+		left := ev.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
+		index := ev.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		return ev.evalIndexExpression(left, index)
+
+	case *ast.MemberExpression:
+		obj := ev.Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+
+		return evalMemberExpression(obj, node.Property.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
+		right := ev.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return ev.track(evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
+		left := ev.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
+		right := ev.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return ev.track(ev.evalInfixExpression(node.Operator, left, right))
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return ev.evalIdentifier(node, env)
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return ev.evalIfExpression(node, env)
 
 	case *ast.FunctionLiteral:
-		return &object.Function{
+		return ev.track(&object.Function{
 			Parameters: node.Parameters,
 			Body:       node.Body,
 			Env:        env,
-		}
+			Scope:      node.Scope,
+		})
 
 	case *ast.CallExpression:
-		if node.Function.TokenLiteral() == "quote" {
-			return quote(node.Arguments[0], env)
-		}
-
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-
-		return applyFunction(function, args)
+		return ev.evalCallExpression(node, env, false)
 	}
 
 	return NULL
 }
 
-func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
+func (ev *Evaluator) evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range stmts {
-		result = Eval(statement, env)
+		result = ev.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return ev.unwrapReturnValue(result)
 		case *object.Error:
 			return result
 		}
@@ -162,11 +190,11 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+func (ev *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object = NULL
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = ev.Eval(statement, env)
 
 		if result != nil {
 			rt := result.Type()
@@ -179,11 +207,41 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (ev *Evaluator) evalCallExpression(node *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	switch node.Function.TokenLiteral() {
+	case "quote":
+		if n := len(node.Arguments); n != 1 {
+			return newError("wrong number of arguments: expected 1, got %d", n)
+		}
+		return ev.quote(node.Arguments[0], env)
+	case "macroexpand":
+		return ev.macroExpand(node, env, true)
+	case "macroexpand1":
+		return ev.macroExpand(node, env, false)
+	}
+
+	function := ev.Eval(node.Function, env)
+	if isError(function) {
+		return function
+	}
+
+	args := ev.evalExpressions(node.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	if tail {
+		return &tailCall{fn: function, args: args}
+	}
+
+	return ev.applyFunction(function, args)
+}
+
+func (ev *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
+		evaluated := ev.Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -194,16 +252,16 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+func (ev *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := ev.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return ev.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return ev.Eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
@@ -214,14 +272,7 @@ func createInteger(value int64) *object.Integer {
 		return &object.Integer{Value: value}
 	}
 
-	if integer, ok := integerCache[value]; ok {
-		return integer
-	}
-
-	integer := &object.Integer{Value: value}
-	integerCache[value] = integer
-
-	return integer
+	return smallIntegers[value+128]
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -232,10 +283,16 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
+func (ev *Evaluator) evalIndexExpression(left, index object.Object) object.Object {
+	if method, ok := object.LookupMethod(left, "[]"); ok {
+		return ev.applyFunction(method, []object.Object{left, index})
+	}
+
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.MAP_OBJ:
 		return evalMapIndexExpression(left, index)
 	default:
@@ -256,15 +313,23 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	char, ok := str.(*object.String).RuneAt(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+
+	return char
+}
+
 func evalMapIndexExpression(mapObj, index object.Object) object.Object {
 	mapObject := mapObj.(*object.Map)
 
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return newError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := mapObject.Pairs[key.HashKey()]
+	pair, ok := mapObject.Get(index.(object.Hashable))
 	if !ok {
 		return NULL
 	}
@@ -272,179 +337,165 @@ func evalMapIndexExpression(mapObj, index object.Object) object.Object {
 	return pair.Value
 }
 
-func evalMapLiteral(node *ast.MapLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+func (ev *Evaluator) evalMapLiteral(node *ast.MapLiteral, env *object.Environment) object.Object {
+	mapObject := object.NewMap()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+	for _, pair := range node.Pairs {
+		key := ev.Eval(pair.Key, env)
 		if isError(key) {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
+		if !object.IsHashable(key) {
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := ev.Eval(pair.Value, env)
 		if isError(value) {
 			return value
 		}
 
-		hash := hashKey.HashKey()
-
-		pairs[hash] = object.HashPair{Key: key, Value: value}
+		mapObject.Set(key.(object.Hashable), value)
 	}
 
-	return &object.Map{Pairs: pairs}
+	return mapObject
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "-":
-		return evalMinusPrefixOperatorExpression(right)
-	default:
-		return newError("unkown operator: %s%s", operator, right.Type())
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	if method, ok := object.LookupMethod(obj, name); ok {
+		return &object.BoundMethod{Receiver: obj, Method: method}
 	}
-}
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
+	if obj.Type() != object.MAP_OBJ {
+		return newError("member access not supported: %s.%s", obj.Type(), name)
 	}
+
+	return evalMapIndexExpression(obj, &object.String{Value: name})
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unkown operator: -%s", right.Type())
+func (ev *Evaluator) evalSetLiteral(node *ast.SetLiteral, env *object.Environment) object.Object {
+	set := object.NewSet()
+
+	for _, elemNode := range node.Elements {
+		elem := ev.Eval(elemNode, env)
+		if isError(elem) {
+			return elem
+		}
+
+		if !object.IsHashable(elem) {
+			return newError("unusable as set element: %s", elem.Type())
+		}
+
+		set.Add(elem.(object.Hashable))
 	}
 
-	value := right.(*object.Integer).Value
-	return createInteger(-value)
+	return set
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
-	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+// evalPrefixExpression is object.Prefix, except that negating an integer
+// gives a shared one if it's small, like integer literals do.
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	if integer, ok := right.(*object.Integer); ok && operator == "-" {
+		return createInteger(-integer.Value)
 	}
-}
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-
-	// Arithmetic
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		if rightVal == 0 {
-			return newError("unsupported operation: division by zero")
-		}
-		return &object.Integer{Value: leftVal / rightVal}
-
-	// Boolean
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	return object.Prefix(operator, right)
+}
 
-	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+func (ev *Evaluator) evalInfixExpression(operator string, left, right object.Object) object.Object {
+	method, args, negate, ok := object.Overload(operator, left, right)
+	if !ok {
+		return object.Infix(operator, left, right)
 	}
-}
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-
-	switch operator {
-	case "+":
-		return &object.String{Value: leftVal + rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	default:
-		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	result := ev.applyFunction(method, args)
+	if isError(result) || !negate {
+		return result
 	}
+
+	return nativeBoolToBooleanObject(!isTruthy(result))
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	if val, ok := env.Get(node.Value); ok {
+func (ev *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if binding := node.Binding; binding != nil {
+		if val, ok := env.GetAt(binding.Depth, binding.Slot, node.Value); ok {
+			return val
+		}
+	} else if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := ev.runtime.Builtin(node.Value); ok {
 		return builtin
 	}
 
 	return newError("identifier not found: %s", node.Value)
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		fnLen := len(fn.Parameters)
-		argsLen := len(args)
-		if fnLen != argsLen {
-			return newError("wrong number of arguments: expected %d, got %d", fnLen, argsLen)
-		}
+func (ev *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
+	if max := ev.maxDepth(); ev.depth >= max {
+		return limitError(limits.DepthError(max))
+	}
+
+	ev.depth += 1
+	result := ev.callFunction(fn, args)
+	ev.depth -= 1
 
-		extendedEnv := extendedFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+	return result
+}
+
+func (ev *Evaluator) callFunction(fn object.Object, args []object.Object) object.Object {
+	// tail calls come back from the function's body as a tailCall and
+	// are run by the next iteration, so they don't nest
+	for {
+		switch f := fn.(type) {
+		case *object.Function:
+			fnLen := len(f.Parameters)
+			argsLen := len(args)
+			if fnLen != argsLen {
+				return newError("wrong number of arguments: expected %d, got %d", fnLen, argsLen)
+			}
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+			extendedEnv := extendedFunctionEnv(f, args)
+			if err := ev.allocate(environmentSize(f)); err != nil {
+				return err
+			}
 
-	default:
-		return newError("not a function: %s", fn.Type())
+			evaluated := ev.evalTail(f.Body, extendedEnv)
+			if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+				evaluated = returnValue.Value
+			}
+
+			call, ok := evaluated.(*tailCall)
+			if !ok {
+				return evaluated
+			}
+			fn, args = call.fn, call.args
+
+		case *object.Builtin:
+			return ev.track(f.Call(ev.context(), args))
+
+		case *object.BoundMethod:
+			fn, args = f.Method, append([]object.Object{f.Receiver}, args...)
+
+		case *object.UserType:
+			return ev.track(object.NewInstance(f, args))
+
+		default:
+			return newError("not a function: %s", fn.Type())
+		}
 	}
 }
 
 func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	if fn.Scope != nil {
+		env := object.NewSlotEnvironment(fn.Env, fn.Scope.Names)
+		for paramIdx := range fn.Parameters {
+			env.SetAt(paramIdx, "", args[paramIdx])
+		}
+		return env
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
@@ -454,7 +505,8 @@ func extendedFunctionEnv(fn *object.Function, args []object.Object) *object.Envi
 	return env
 }
 
-func unwrapReturnValue(obj object.Object) object.Object {
+// unwrapReturnValue returns the value of a return statement.
+func (ev *Evaluator) unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
 	}
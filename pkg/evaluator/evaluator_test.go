@@ -6,6 +6,7 @@ import (
 
 	"github.com/estevesnp/dsb/pkg/ast"
 	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/limits"
 	"github.com/estevesnp/dsb/pkg/object"
 	"github.com/estevesnp/dsb/pkg/parser"
 )
@@ -66,6 +67,8 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 }
 
 func TestIntegerCache(t *testing.T) {
+	skipOnVM(t, "the integer cache belongs to the evaluator")
+
 	tests := []struct {
 		input        string
 		expectedSame bool
@@ -108,6 +111,117 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5", "1.5"},
+		{"-2.25", "-2.25"},
+		{"1.5 + 1.5", "3.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"7 / 2.0", "3.5"},
+		{"2 * 1.5 - 1", "2.0"},
+		{"1.0 == 1", "true"},
+		{"2.5 > 2", "true"},
+		{"1 <= 0.5", "false"},
+		{"1.0 / 0", "unsupported operation: division by zero"},
+		{"-true", "unkown operator: -BOOLEAN"},
+		{`1.5 + "a"`, "type mismatch: FLOAT + STRING"},
+		{"sort([2, 1.5, 1, 0.5])", "[0.5, 1, 1.5, 2]"},
+		{"{1.5: 1}[1.5]", "1"},
+
+		// an integer and a float with the same value are equal, and so are the
+		// same map key and set element
+		{"1 != 1.0", "false"},
+		{"9007199254740993 == 9007199254740992.0", "false"},
+		{"[1, [2]] == [1.0, [2.0]]", "true"},
+		{"{1: 2} == {1.0: 2.0}", "true"},
+		{"1.0 in [1]", "true"},
+		{"1 in {1.0}", "true"},
+		{"2.0 in {2: true}", "true"},
+		{"1.5 in {1: true}", "false"},
+		{`{1: "a"}[1.0]`, "a"},
+		{`{1.0: "a"}[1]`, "a"},
+		{`len(keys({1: "a", 1.0: "b"}))`, "1"},
+		{`{1: "a", 1.0: "b"}[1]`, "b"},
+		{"len({1, 1.0, -0.0, 0})", "2"},
+		{"len(set([1, 1.0, 2]))", "2"},
+		{"{[1]: true}[[1.0]]", "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`int("42") + 1`, "43"},
+		{`int("-7")`, "-7"},
+		{"int(3.99)", "3"},
+		{"int(-3.99)", "-3"},
+		{"int(true)", "1"},
+		{"int(5)", "5"},
+		{`int("4x")`, `cannot parse "4x" as INTEGER`},
+		{`int("99999999999999999999")`, `"99999999999999999999" is out of range for INTEGER`},
+		{"int([])", "argument to `int` not supported, got ARRAY"},
+		{"int()", "wrong number of arguments: expected 1, got 0"},
+
+		{`float("2.5") * 2`, "5.0"},
+		{"float(3)", "3.0"},
+		{"float(false)", "0.0"},
+		{`float("abc")`, `cannot parse "abc" as FLOAT`},
+		{"float(null)", "argument to `float` not supported, got NULL"},
+
+		{`str(42) + "!"`, "42!"},
+		{"str(1.5)", "1.5"},
+		{`str([1, "a"])`, "[1, a]"},
+		{"toString(null)", "null"},
+		{"str(int(str(12)))", "12"},
+
+		{"bool(0)", "true"},
+		{`bool("")`, "true"},
+		{"bool(null)", "false"},
+		{"bool(false)", "false"},
+
+		{`parseInt("ff", 16)`, "255"},
+		{`parseInt("-101", 2)`, "-5"},
+		{`parseInt("0x1f", 0)`, "31"},
+		{`parseInt("12")`, "12"},
+		{`parseInt("12", 2)`, `cannot parse "12" as INTEGER in base 2`},
+		{`parseInt("1", 37)`, "base to `parseInt` must be 0 or between 2 and 36, got 37"},
+		{`parseInt("1", "2")`, "base to `parseInt` must be INTEGER, got STRING"},
+		{"parseInt(1)", "argument to `parseInt` not supported, got INTEGER"},
+		{"parseInt()", "wrong number of arguments: expected 1 or 2, got 0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %s. want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	expected := "Hello World!"
@@ -123,6 +237,41 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[2]`, "c"},
+		{`let s = "héllo"; s[1] + s[2]`, "él"},
+		{`"日本"[1]`, "本"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got %T (%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if str.Value != expected {
+			t.Errorf("wrong string for %s. want %q, got %q", tt.input, expected, str.Value)
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -273,6 +422,22 @@ func TestMapIndexExpression(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{[2024, 1]: 5}[[2024, 1]]`,
+			5,
+		},
+		{
+			`let year = 2024; let month = 1; {[year, month]: 5}[[2024, 1]]`,
+			5,
+		},
+		{
+			`{[2024, 1]: 5}[[1, 2024]]`,
+			nil,
+		},
+		{
+			`{{"a": [1]}: 5}[{"a": [1]}]`,
+			5,
+		},
 	}
 
 	for _, tt := range tests {
@@ -341,6 +506,22 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"null == 5", false},
 		{"null != 5", true},
 		{"null == fn(){}()", true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{`[1, [2, "a"]] == [1, [2, "a"]]`, true},
+		{"[] == []", true},
+		{"[1] == 1", false},
+		{`{"a": [1], "b": 2} == {"b": 2, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} != {"a": 1, "b": 2}`, true},
+		{"let f = fn() {}; f == f", true},
+		{"fn() {} == fn() {}", false},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{"[2] > [1, 9]", true},
+		{"[1, 2] <= [1, 2]", true},
+		{`[1, "a"] >= [1, 2]`, true},
 	}
 
 	for _, tt := range tests {
@@ -383,15 +564,6 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
-func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
-
-	return Eval(program, env)
-}
-
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -518,6 +690,18 @@ if (10 > 1) {
 			`{"foo": "bar"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"quote()",
+			"wrong number of arguments: expected 1, got 0",
+		},
+		{
+			`{[1, fn(x) { x }]: "bar"}`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			`{"foo": "bar"}[{"foo": fn(x) { x }}];`,
+			"unusable as hash key: MAP",
+		},
 	}
 
 	for _, tt := range tests {
@@ -552,6 +736,8 @@ func TestLetStatements(t *testing.T) {
 }
 
 func TestFunctionObject(t *testing.T) {
+	skipOnVM(t, "the VM represents functions as closures")
+
 	input := "fn(x) { x + 2; };"
 
 	evaluated := testEval(input)
@@ -606,6 +792,123 @@ addTwo(2);`
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 5; fn() { let x = x * 2; x }()", 10},
+		{"let x = 5; fn(x) { x }(7)", 7},
+		{"fn(x) { let x = x + 1; x }(1)", 2},
+		{"fn(a) { fn(b) { fn(c) { a + b + c } } }(1)(2)(3)", 6},
+		{"fn(n) { if (n > 0) { let y = n; y } else { 0 } }(4)", 4},
+		{"let len = fn(x) { 42 }; len([1])", 42},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLateBoundLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn() { let f = fn() { g() }; let g = fn() { 7 }; f() }()", 7},
+		{"let f = fn(x) { let getX = fn() { x }; let x = 3; getX() }; f(1)", 3},
+		{"fn(a, a) { a }(1, 2)", 2},
+		{"fn(a, a) { fn() { a } }(1, 2)()", 2},
+		{"let f = fn() { let n = 1; let get = fn() { n }; let n = n + 1; get() }; f()", 2},
+		{"let x = 1; let f = fn() { let x = x + 1; let g = fn() { x }; g() }; f()", 2},
+		{"let z = 9; let f = fn() { let g = fn() { z }; let r = z; let z = 2; r * 10 + g() }; f()", 92},
+		{
+			`fn() {
+				let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } };
+				let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } };
+				even(100000)
+			}()`,
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let loop = fn(n, acc) { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; loop(1000000, 0)", 1000000},
+		{"let loop = fn(n) { if (n == 0) { return 0 }; return loop(n - 1) }; loop(100000)", 0},
+		{"let loop = fn(n) { if (n > 0) { return loop(n - 1) }; 7 }; loop(100000)", 7},
+		{
+			`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+			let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+			let count = fn(n) { if (even(n)) { 1 } else { 0 } };
+			count(100000)`,
+			1,
+		},
+		{
+			`let T = type("T", {"down": fn(t, n) { if (n == 0) { 3 } else { t.down(n - 1) } }});
+			T({}).down(100000)`,
+			3,
+		},
+		{"let loop = fn(n) { if (n == 0) { 5 } else { loop(n - 1) } }; if (true) { return loop(100000) }", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestReturnInExpression(t *testing.T) {
+	skipOnVM(t, "a return in an expression returns from the function on the VM")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) { x * 2 }; str(if (true) { return f(1) })", "2"},
+		{"let f = fn(x) { x * 2 }; fn() { str(if (true) { return f(2) }) }()", "4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Fatalf("object is not String. got %T (%+v)", evaluated, evaluated)
+		}
+
+		if str.Value != tt.expected {
+			t.Errorf("String is not %q, got %q", tt.expected, str.Value)
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	lim := limits.Limits{MaxDepth: 100}
+
+	input := "let deep = fn(n) { if (n == 0) { 0 } else { 1 + deep(n - 1) } };"
+
+	testIntegerObject(t, testEvalWithLimits(input+"deep(99)", lim), 99)
+
+	errObj, ok := testEvalWithLimits(input+"deep(100)", lim).(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error for a call nested too deep")
+	}
+
+	expected := "stack overflow: more than 100 nested calls"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. want %q, got %q", expected, errObj.Message)
+	}
+
+	testIntegerObject(t, testEvalWithLimits(input+"deep(50)", lim), 50)
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -659,6 +962,49 @@ func TestBuiltinFunctions(t *testing.T) {
 		{"push(0, 0)", errors.New("argument to `push` not supported, got INTEGER")},
 		{"push()", errors.New("wrong number of arguments: expected at least 2, got 0")},
 		{"push([])", errors.New("wrong number of arguments: expected at least 2, got 1")},
+
+		{"sort([])", []int{}},
+		{"sort([3, 1, 2])", []int{1, 2, 3}},
+		{"sort([2, 1, 2, -5])", []int{-5, 1, 2, 2}},
+		{"sort(1)", errors.New("argument to `sort` not supported, got INTEGER")},
+		{"sort()", errors.New("wrong number of arguments: expected 1, got 0")},
+
+		{`format("%-5s|%3d|%.1f", "ab", 7, 2)`, "ab   |  7|2.0"},
+		{`format("%v and %q", [1], "x")`, `[1] and "x"`},
+		{`format("no verbs")`, "no verbs"},
+		{`format("%d", "7")`, errors.New(`format "%d": %d needs an INTEGER, got STRING`)},
+		{`format(1)`, errors.New("argument to `format` must be STRING, got INTEGER")},
+		{`format()`, errors.New("wrong number of arguments: expected at least 1, got 0")},
+
+		{`strings.join(strings.split("a,b,,c", ","), "|")`, "a|b||c"},
+		{`len(strings.split("a, b", ", "))`, 2},
+		{`strings.join([], ",")`, ""},
+		{`strings.trim("  hi  ")`, "hi"},
+		{`strings.upper("abc") + strings.lower("DEF")`, "ABCdef"},
+		{`format("%v %v %v", strings.contains("hello", "ell"), strings.startsWith("hello", "he"), strings.endsWith("hello", "he"))`, "true true false"},
+		{`strings.replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`strings.replace("ab", "", "-")`, "-a-b-"},
+		{`strings.replace("ab", "z", "-")`, "ab"},
+		{`strings.join(strings.split("hé", ""), ".")`, "h.é"},
+		{`strings.indexOf("héllo", "l")`, 2},
+		{`strings.indexOf("hello", "z")`, -1},
+		{`strings.repeat("ab", 3)`, "ababab"},
+		{`strings.padLeft("7", 3, "0") + strings.padLeft("x", 2) + strings.padLeft("long", 2)`, "007 xlong"},
+		{`strings.join(strings.chars("héj"), " ")`, "h é j"},
+		{`strings.bytes("hé")`, []int{104, 195, 169}},
+		{`strings.join([1], ",")`, errors.New("argument 1 to `strings.join` not supported: element 0: cannot convert INTEGER to string")},
+		{`strings.upper()`, errors.New("wrong number of arguments: expected 1, got 0")},
+		{`strings.repeat("a", -1)`, errors.New("negative count to `strings.repeat`")},
+		{`strings.repeat("ab", 9223372036854775807)`, errors.New("result of `strings.repeat` would be too long")},
+		{`strings.padLeft("a", 9223372036854775807, "é")`, errors.New("result of `strings.padLeft` would be too long")},
+		{`json.stringify(json.parse(json.stringify({"b": [1, 2.5, null], "a": true})))`, `{"b":[1,2.5,null],"a":true}`},
+		{`json.parse(json.stringify({"n": 4})).n * 2`, 8},
+		{`json.parse("[1, 2, 3]")[2]`, 3},
+		{`json.stringify({"name": "ana", "tags": {"x"}}, 1)`, "{\n \"name\": \"ana\",\n \"tags\": [\n  \"x\"\n ]\n}"},
+		{`json.stringify(fn(x) { x })`, errors.New("cannot stringify: FUNCTION has no JSON representation")},
+		{`json.parse("[1,")`, errors.New("invalid JSON: unexpected end of JSON input")},
+		{`json.parse(1)`, errors.New("argument to `json.parse` not supported, got INTEGER")},
+		{`strings.padLeft("a", 3, "ab")`, errors.New("padding for `strings.padLeft` must be a single character, got \"ab\"")},
 	}
 
 	for _, tt := range tests {
@@ -773,3 +1119,236 @@ func testParseProgram(input string) *ast.Program {
 	p := parser.New(l)
 	return p.ParseProgram()
 }
+
+func TestSortMixedArray(t *testing.T) {
+	input := `sort(["b", [1, 2], 3, null, {"a": 1}, true, [1], "a", false, 1])`
+	expected := `[null, false, true, 1, 3, a, b, [1], [1, 2], {a: 1}]`
+
+	evaluated := testEval(input)
+	if got := evaluated.Inspect(); got != expected {
+		t.Errorf("wrong sort order. want %q, got %q", expected, got)
+	}
+}
+
+func TestUserTypes(t *testing.T) {
+	vector := `
+let Vector = type("Vector", {
+    "+": fn(a, b) { Vector({"x": a.x + b.x, "y": a.y + b.y}) },
+    "==": fn(a, b) { if (a.x == b.x) { a.y == b.y } else { false } },
+    "<": fn(a, b) { a.norm() < b.norm() },
+    "[]": fn(self, idx) { if (idx == 0) { self.x } else { self.y } },
+    "norm": fn(self) { self.x * self.x + self.y * self.y },
+    "scale": fn(self, k) { Vector({"x": self.x * k, "y": self.y * k}) },
+});
+let a = Vector({"x": 1, "y": 2});
+let b = Vector({"x": 3, "y": 4});
+`
+
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"a.x", 1},
+		{"b.y", 4},
+		{"a.z", nil},
+		{"a.norm()", 5},
+		{"a.scale(3).y", 6},
+		{"(a + b).x", 4},
+		{"(a + b).y", 6},
+		{"a[0]", 1},
+		{"b[1]", 4},
+		{"a < b", true},
+		{"a > b", false},
+		{"a <= b", true},
+		{"a >= b", false},
+		{"b >= b", true},
+		{`a == Vector({"x": 1, "y": 2})`, true},
+		{"a != b", true},
+		{`typeOf(a)`, "Vector"},
+		{`typeOf(Vector)`, "USER_TYPE"},
+		{`let m = a.norm; m()`, 5},
+		{`{"x": 1}.x`, 1},
+		{`Vector().x`, nil},
+		{"a - b", errors.New("unkown operator: MAP - MAP")},
+		{"a.size()", errors.New("not a function: NULL")},
+		{"1.foo", errors.New("member access not supported: INTEGER.foo")},
+		{`Vector(1)`, errors.New("argument to `Vector` not supported, got INTEGER")},
+		{`type("T", {"m": 1})`, errors.New(`method "m" is not a function, got INTEGER`)},
+		{`type("T", {1: fn() {}})`, errors.New("method name must be STRING, got INTEGER")},
+		{`type("T")`, errors.New("wrong number of arguments: expected 2, got 1")},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(vector + tt.input)
+		testExpectedObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestOverloadedEquality(t *testing.T) {
+	input := `
+let Money = type("Money", {
+    "==": fn(a, b) { a.cents == b.cents },
+});
+let ten = Money({"cents": 1000, "currency": "EUR"});
+let alsoTen = Money({"cents": 1000, "currency": "USD"});
+let five = Money({"cents": 500, "currency": "EUR"});
+`
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"ten == alsoTen", true},
+		{"ten != alsoTen", false},
+		{"ten == five", false},
+		{"ten != five", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(input+tt.input), tt.expected)
+	}
+}
+
+func testExpectedObject(t *testing.T, obj object.Object, expected any) bool {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case string:
+		str, ok := obj.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got %T (%+v)", obj, obj)
+			return false
+		}
+
+		if str.Value != expected {
+			t.Errorf("wrong string value. want %q, got %q", expected, str.Value)
+			return false
+		}
+	case error:
+		errObj, ok := obj.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error. got %T (%+v)", obj, obj)
+			return false
+		}
+
+		if errObj.Message != expected.Error() {
+			t.Errorf("wrong error message. expected %q, got %q", expected.Error(), errObj.Message)
+			return false
+		}
+	case nil:
+		return testNullObject(t, obj)
+	default:
+		t.Errorf("type of expected not handled. got %T", expected)
+		return false
+	}
+
+	return true
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"typeOf({1, 2})", "SET"},
+		{"len({1, 2, 2, 1})", 2},
+		{"len(set())", 0},
+		{"len(set([1, 2, 3, 3]))", 3},
+		{"{1, 2} == {2, 1}", true},
+		{"{1, 2} == {1, 2, 3}", false},
+		{"{[1, 2], {3}} == {{3}, [1, 2]}", true},
+		{"1 in {1, 2}", true},
+		{"3 in {1, 2}", false},
+		{"[1, 2] in {[1, 2]}", true},
+		{"fn() {} in {1}", false},
+		{`"a" in {"a": 1}`, true},
+		{`"b" in {"a": 1}`, false},
+		{"2 in [1, 2]", true},
+		{"[2] in [1, [2]]", true},
+		{"3 in [1, 2]", false},
+		{`"ell" in "hello"`, true},
+		{`"elo" in "hello"`, false},
+		{"union({1, 2}, {2, 3}) == {1, 2, 3}", true},
+		{"intersection({1, 2}, {2, 3}) == {2}", true},
+		{"difference({1, 2}, {2, 3}) == {1}", true},
+		{"isSubset({1}, {1, 2})", true},
+		{"isSubset({1, 3}, {1, 2})", false},
+		{"isSubset(set(), {1})", true},
+		{"isSuperset({1, 2}, {2})", true},
+		{"isSuperset({2}, {1, 2})", false},
+		{"toArray({3, 1, 2})[0]", 3},
+		{"len(toArray({3, 1, 2}))", 3},
+		{"{{1, 2}: 5}[{2, 1}]", 5},
+		{"1 in 1", errors.New("unkown operator: INTEGER in INTEGER")},
+		{`1 in "1"`, errors.New("unkown operator: INTEGER in STRING")},
+		{"{fn() {}}", errors.New("unusable as set element: FUNCTION")},
+		{"set([fn() {}])", errors.New("unusable as set element: FUNCTION")},
+		{"set(1)", errors.New("argument to `set` not supported, got INTEGER")},
+		{"union({1}, [1])", errors.New("argument to `union` not supported, got ARRAY")},
+		{"union({1})", errors.New("wrong number of arguments: expected 2, got 1")},
+		{"toArray([1])", errors.New("argument to `toArray` not supported, got ARRAY")},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSetInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{3, 1, 2, 1}", "{3, 1, 2}"},
+		{"set()", "set()"},
+		{`union({"a"}, {"b", "a"})`, "{a, b}"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. want %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestMapInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: "c", true: [4]}`, "{b: 1, a: 2, 3: c, true: [4]}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`keys({"z": 1, "y": 2, "x": 3})`, "[z, y, x]"},
+		{`values({"z": 1, "y": 2, "x": 3})`, "[1, 2, 3]"},
+		{`entries({"z": 1, "y": 2})`, "[[z, 1], [y, 2]]"},
+		{`keys({})`, "[]"},
+		{`let P = type("P", {}); P({"y": 1, "x": 2})`, "P{y: 1, x: 2}"},
+	}
+
+	for _, tt := range tests {
+		for range 10 {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Fatalf("wrong Inspect for %q. want %q, got %q", tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestMapBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"keys([])", errors.New("argument to `keys` not supported, got ARRAY")},
+		{"values(1)", errors.New("argument to `values` not supported, got INTEGER")},
+		{"entries()", errors.New("wrong number of arguments: expected 1, got 0")},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
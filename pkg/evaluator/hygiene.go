@@ -0,0 +1,154 @@
+package evaluator
+
+import (
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+// makeHygienic renames the bindings a macro introduced in its expansion, so
+// they can neither capture nor shadow the caller's names. Nodes that came
+// from the call's arguments belong to the caller and are left untouched, as
+// are names the expansion uses without binding them.
+//
+// Only the references in a renamed binding's scope are renamed, so a name
+// the macro binds in one function can still refer to the caller's variable
+// elsewhere in the expansion. Like in the resolver, a scope is the
+// expansion itself or a function's body, and a let binds its name in the
+// whole of it.
+func makeHygienic(expanded ast.Node, call *ast.CallExpression) {
+	fromCaller := map[ast.Node]bool{}
+	for _, arg := range call.Arguments {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			if node != nil {
+				fromCaller[node] = true
+			}
+			return true
+		})
+	}
+
+	h := &hygiene{fromCaller: fromCaller}
+	h.scope(nil, nil, expanded)
+}
+
+type hygiene struct {
+	fromCaller map[ast.Node]bool
+}
+
+// hygieneScope maps the names bound in a scope to what references to them
+// become: a fresh name if the macro bound them, or the same name if the
+// caller did.
+type hygieneScope struct {
+	outer *hygieneScope
+	names map[string]string
+}
+
+// lookup returns what a reference to name in s becomes.
+func (s *hygieneScope) lookup(name string) string {
+	for ; s != nil; s = s.outer {
+		if renamed, ok := s.names[name]; ok {
+			return renamed
+		}
+	}
+
+	return name
+}
+
+// scope renames the bindings made in body, a new scope inside outer with
+// params as its parameters, and the references to them.
+func (h *hygiene) scope(outer *hygieneScope, params []*ast.Identifier, body ast.Node) {
+	s := &hygieneScope{outer: outer, names: map[string]string{}}
+
+	for _, param := range params {
+		h.bind(s, param)
+	}
+
+	for _, param := range params {
+		h.rename(s, param)
+	}
+
+	if body == nil {
+		return
+	}
+
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			h.bind(s, node.Name)
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		}
+		return true
+	})
+
+	h.references(s, body)
+}
+
+// bind records ident, a name bound in s.
+func (h *hygiene) bind(s *hygieneScope, ident *ast.Identifier) {
+	if ident == nil {
+		return
+	}
+
+	renamed, ok := s.names[ident.Value]
+
+	switch {
+	case h.fromCaller[ident]:
+		if !ok {
+			s.names[ident.Value] = ident.Value
+		}
+	case !ok || renamed == ident.Value:
+		s.names[ident.Value] = object.FreshName(ident.Value)
+	}
+}
+
+// references renames the identifiers in node, which is in s, skipping
+// those that came from the caller and property names.
+func (h *hygiene) references(s *hygieneScope, node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if h.fromCaller[node] {
+			return false
+		}
+
+		switch node := node.(type) {
+
+		case *ast.Identifier:
+			h.rename(s, node)
+
+		case *ast.MemberExpression:
+			h.references(s, node.Object)
+			return false
+
+		case *ast.FunctionLiteral:
+			h.function(s, node.Parameters, node.Body)
+			return false
+
+		case *ast.MacroLiteral:
+			h.function(s, node.Parameters, node.Body)
+			return false
+		}
+
+		return true
+	})
+}
+
+// function makes the scope of a function or macro literal, whose body can
+// be nil.
+func (h *hygiene) function(outer *hygieneScope, params []*ast.Identifier, body *ast.BlockStatement) {
+	if body == nil {
+		h.scope(outer, params, nil)
+		return
+	}
+
+	h.scope(outer, params, body)
+}
+
+func (h *hygiene) rename(s *hygieneScope, ident *ast.Identifier) {
+	if h.fromCaller[ident] {
+		return
+	}
+
+	if renamed := s.lookup(ident.Value); renamed != ident.Value {
+		ident.Value = renamed
+		ident.Token.Literal = renamed
+	}
+}
@@ -0,0 +1,154 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+// EvalContext evaluates node like Eval, stopping with an error once ctx is
+// done or the run goes over one of lim's limits. The error's Err is the
+// cause, ctx.Err() or one of the errors in the limits package.
+func (ev *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment, lim limits.Limits) object.Object {
+	return ev.limited(ctx, lim, func() object.Object {
+		return ev.Eval(node, env)
+	})
+}
+
+// ApplyContext calls fn with args, with the same limits as EvalContext, so
+// a program embedding dsb can call the functions it defines.
+func (ev *Evaluator) ApplyContext(ctx context.Context, fn object.Object, args []object.Object, lim limits.Limits) object.Object {
+	return ev.limited(ctx, lim, func() object.Object {
+		return ev.applyFunction(fn, args)
+	})
+}
+
+// ExpandMacrosContext expands macros like ExpandMacros, running their bodies
+// with the same limits as EvalContext.
+func (ev *Evaluator) ExpandMacrosContext(ctx context.Context, program ast.Node, env *object.Environment, lim limits.Limits) (ast.Node, error) {
+	return ev.MacroExpandContext(ctx, program, env, true, lim)
+}
+
+// MacroExpandContext is MacroExpand with the same limits as EvalContext.
+func (ev *Evaluator) MacroExpandContext(ctx context.Context, node ast.Node, env *object.Environment, all bool, lim limits.Limits) (ast.Node, error) {
+	var expanded ast.Node
+	var err error
+
+	limitErr := ev.metered(ctx, lim, func() {
+		expanded, err = ev.MacroExpand(node, env, all)
+	})
+
+	// the macro's error only explains the limit if it's caused by it
+	if limitErr != nil && !errors.Is(err, limitErr) {
+		return nil, limitErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded, nil
+}
+
+func (ev *Evaluator) limited(ctx context.Context, lim limits.Limits, run func() object.Object) object.Object {
+	var res object.Object
+
+	if err := ev.metered(ctx, lim, func() { res = run() }); err != nil {
+		return limitError(err)
+	}
+
+	return res
+}
+
+// metered runs run under a new meter for ctx and lim, returning the error
+// that stopped it, if any. An error from the limits can be swallowed on its
+// way out, like by a builtin that only checks whether its callback returned
+// true, so it's taken from the meter. The meter of a run that was already
+// going, like one that called a builtin expanding macros, is put back after.
+func (ev *Evaluator) metered(ctx context.Context, lim limits.Limits, run func()) error {
+	outer := ev.meter
+	ev.meter = limits.NewMeter(ctx, lim)
+	defer func() {
+		ev.meter = outer
+	}()
+
+	run()
+
+	return ev.meter.Err()
+}
+
+// context returns the context of the current run, which builtins get.
+func (ev *Evaluator) context() context.Context {
+	if ev.meter == nil {
+		return context.Background()
+	}
+
+	return ev.meter.Context()
+}
+
+// maxDepth is how many calls can be nested in the current run.
+func (ev *Evaluator) maxDepth() int {
+	if ev.meter == nil {
+		return defaultMaxDepth
+	}
+
+	return ev.meter.MaxDepth(defaultMaxDepth)
+}
+
+// step counts a step of the run, returning an error if it's over its
+// limits.
+func (ev *Evaluator) step() *object.Error {
+	if ev.meter == nil {
+		return nil
+	}
+
+	if err := ev.meter.Step(); err != nil {
+		return limitError(err)
+	}
+
+	return nil
+}
+
+// track counts obj, which was just created, towards the run's allocation
+// limit, returning an error instead if it's over it.
+func (ev *Evaluator) track(obj object.Object) object.Object {
+	if isError(obj) {
+		return obj
+	}
+
+	if err := ev.allocate(limits.SizeOf(obj)); err != nil {
+		return err
+	}
+
+	return obj
+}
+
+// allocate counts size bytes towards the run's allocation limit.
+func (ev *Evaluator) allocate(size int64) *object.Error {
+	if ev.meter == nil {
+		return nil
+	}
+
+	if err := ev.meter.Alloc(size); err != nil {
+		return limitError(err)
+	}
+
+	return nil
+}
+
+// environmentSize is what calling fn allocates for its environment.
+func environmentSize(fn *object.Function) int64 {
+	locals := len(fn.Parameters)
+	if fn.Scope != nil {
+		locals = len(fn.Scope.Names)
+	}
+
+	return limits.EnvironmentSize(locals)
+}
+
+func limitError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Err: err}
+}
@@ -1,10 +1,57 @@
 package evaluator
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/estevesnp/dsb/pkg/ast"
 	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
 )
 
+const maxMacroExpansionDepth = 64
+
+type MacroFrame struct {
+	Name       string
+	Definition token.Position
+	CallSite   token.Position
+}
+
+func (mf MacroFrame) String() string {
+	return fmt.Sprintf("macro %q (defined at %s) called at %s", mf.Name, mf.Definition, mf.CallSite)
+}
+
+// MacroError describes a failed expansion. Trace holds every macro being
+// expanded when the error happened, outermost first, so the last frame is
+// the macro that failed. Err is the cause, if the macro's body failed
+// with one, like going over the limits of the run.
+type MacroError struct {
+	Message string
+	Err     error
+	Trace   []MacroFrame
+}
+
+func (me *MacroError) Error() string {
+	var out strings.Builder
+
+	if n := len(me.Trace); n > 0 {
+		out.WriteString(me.Trace[n-1].String())
+		out.WriteString(": ")
+	}
+	out.WriteString(me.Message)
+
+	for i := len(me.Trace) - 2; i >= 0; i -= 1 {
+		out.WriteString("\n\tin expansion of ")
+		out.WriteString(me.Trace[i].String())
+	}
+
+	return out.String()
+}
+
+func (me *MacroError) Unwrap() error {
+	return me.Err
+}
+
 func DefineMacros(program *ast.Program, env *object.Environment) {
 	definitions := []int{}
 
@@ -41,13 +88,37 @@ func addMacro(stmt ast.Statement, env *object.Environment) {
 		Parameters: macroLiteral.Parameters,
 		Env:        env,
 		Body:       macroLiteral.Body,
+		Pos:        macroLiteral.Token.Pos,
 	}
 
 	env.Set(letStatement.Name.Value, macro)
 }
 
-func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
-	return ast.Modify(program, func(node ast.Node) ast.Node {
+// ExpandMacros expands the macro calls in program with a new Runtime.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return New(object.NewRuntime()).ExpandMacros(program, env)
+}
+
+// ExpandMacros returns program with every call to a macro defined in env
+// replaced by its expansion.
+func (ev *Evaluator) ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	return ev.expandMacros(program, env, nil)
+}
+
+func (ev *Evaluator) expandMacros(node ast.Node, env *object.Environment, trace []MacroFrame) (ast.Node, error) {
+	var expansionErr error
+
+	// quoted code is data, so macro calls inside it are left for
+	// macroexpand or for whoever unquotes it later
+	notQuoted := func(node ast.Node) bool {
+		return !isCallTo(node, "quote")
+	}
+
+	modified, err := ast.Apply(node, notQuoted, func(node ast.Node) ast.Node {
+		if expansionErr != nil {
+			return node
+		}
+
 		callExpression, ok := node.(*ast.CallExpression)
 		if !ok {
 			return node
@@ -58,18 +129,129 @@ func ExpandMacros(program ast.Node, env *object.Environment) ast.Node {
 			return node
 		}
 
-		args := quoteArgs(callExpression)
-		evalEnv := extendedMacroEnv(macro, args)
+		expanded, err := ev.expandMacroCall(callExpression, macro, env, pushFrame(trace, callExpression, macro))
+		if err != nil {
+			expansionErr = err
+			return node
+		}
 
-		evaluated := Eval(macro.Body, evalEnv)
+		return expanded
+	})
 
-		quote, ok := evaluated.(*object.Quote)
-		if !ok {
-			panic("only AST nodes are supported from macros")
+	if expansionErr != nil {
+		return nil, expansionErr
+	}
+
+	if err != nil {
+		return nil, &MacroError{Message: err.Error(), Trace: trace}
+	}
+
+	return modified, nil
+}
+
+func pushFrame(trace []MacroFrame, call *ast.CallExpression, macro *object.Macro) []MacroFrame {
+	frame := MacroFrame{
+		Name:       call.Function.String(),
+		Definition: macro.Pos,
+		CallSite:   ast.Pos(call),
+	}
+
+	return append(trace[:len(trace):len(trace)], frame)
+}
+
+func (ev *Evaluator) expandMacroCall(call *ast.CallExpression, macro *object.Macro, env *object.Environment, trace []MacroFrame) (ast.Node, error) {
+	expanded, err := ev.expandMacroCallOnce(call, macro, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	return ev.expandMacros(expanded, env, trace)
+}
+
+// expandMacroCallOnce runs a single macro call and returns its expansion,
+// which may itself contain more macro calls.
+func (ev *Evaluator) expandMacroCallOnce(call *ast.CallExpression, macro *object.Macro, trace []MacroFrame) (ast.Node, error) {
+	if len(trace) > maxMacroExpansionDepth {
+		return nil, &MacroError{
+			Message: fmt.Sprintf("expansion exceeded the maximum depth of %d", maxMacroExpansionDepth),
+			Trace:   trace,
 		}
+	}
 
-		return quote.Node
-	})
+	if want, got := len(macro.Parameters), len(call.Arguments); want != got {
+		return nil, &MacroError{
+			Message: fmt.Sprintf("wrong number of arguments: expected %d, got %d", want, got),
+			Trace:   trace,
+		}
+	}
+
+	args := quoteArgs(call)
+	evalEnv := extendedMacroEnv(macro, args)
+
+	evaluated := ev.unwrapReturnValue(ev.Eval(macro.Body, evalEnv))
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		return nil, &MacroError{Message: errObj.Message, Err: errObj.Err, Trace: trace}
+	}
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		return nil, &MacroError{
+			Message: fmt.Sprintf("macro must return a quoted AST node, got %s", typeName(evaluated)),
+			Trace:   trace,
+		}
+	}
+
+	if !quote.Unhygienic {
+		makeHygienic(quote.Node, call)
+	}
+
+	return quote.Node, nil
+}
+
+// macroExpand implements the macroexpand and macroexpand1 forms. The quoted
+// node is copied first, so the original quote is left as it was. With all
+// set it expands every macro call, otherwise only a macro call at the top
+// of the node, and only by one step.
+func (ev *Evaluator) macroExpand(call *ast.CallExpression, env *object.Environment, all bool) object.Object {
+	if n := len(call.Arguments); n != 1 {
+		return newError("wrong number of arguments: expected 1, got %d", n)
+	}
+
+	evaluated := ev.Eval(call.Arguments[0], env)
+	if isError(evaluated) {
+		return evaluated
+	}
+
+	quoted, ok := evaluated.(*object.Quote)
+	if !ok {
+		return newError("argument to `%s` not supported, got %s", call.Function.TokenLiteral(), typeName(evaluated))
+	}
+
+	node, err := ev.MacroExpand(ast.Copy(quoted.Node), env, all)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// MacroExpand expands the macro calls in node with the macros defined in
+// env, or with all unset only a macro call at the top of node, by one step.
+// It's what macroexpand and macroexpand1 do, given to a Runtime's Expand so
+// they can be called on the VM too.
+func (ev *Evaluator) MacroExpand(node ast.Node, env *object.Environment, all bool) (ast.Node, error) {
+	if all {
+		return ev.ExpandMacros(node, env)
+	}
+
+	if macroCall, ok := node.(*ast.CallExpression); ok {
+		if macro, ok := isMacroCall(macroCall, env); ok {
+			return ev.expandMacroCallOnce(macroCall, macro, pushFrame(nil, macroCall, macro))
+		}
+	}
+
+	return node, nil
 }
 
 func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
@@ -110,3 +292,20 @@ func extendedMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environ
 
 	return extended
 }
+
+func typeName(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+
+	return obj.Type()
+}
+
+func isCallTo(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return call.Function.TokenLiteral() == name
+}
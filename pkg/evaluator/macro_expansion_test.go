@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/estevesnp/dsb/pkg/object"
@@ -45,10 +47,302 @@ unless(10 > 5, print("not greater"), print("greater"));`,
 		env := object.NewEnvironment()
 
 		DefineMacros(program, env)
-		expanded := ExpandMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error expanding macros: %v", err)
+		}
 
 		if expanded.String() != expected.String() {
 			t.Errorf("not equal. want %q, got %q", expected.String(), expanded.String())
 		}
 	}
 }
+
+func TestExpandNestedMacroCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+let double = macro(x) { quote(unquote(x) * 2); };
+print(double(1 + 1));`,
+			"print(((1 + 1) * 2))",
+		},
+		{
+			`
+let double = macro(x) { quote(unquote(x) * 2); };
+add(double(1), [double(2)]);`,
+			"add((1 * 2), [(2 * 2)])",
+		},
+		{
+			`
+let double = macro(x) { quote(unquote(x) * 2); };
+double(1); double(2);`,
+			"(1 * 2)(2 * 2)",
+		},
+		{
+			`
+let call = macro(f, x) { quote(unquote(f)(unquote(x) + 1)); };
+call(g, 1);`,
+			"g((1 + 1))",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Fatalf("unexpected error expanding macros: %v", err)
+		}
+
+		if got := expanded.String(); got != tt.expected {
+			t.Errorf("not equal. want %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestExpandMacroErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{
+			`let unless = macro(cond, cons, alt) { quote(1) };
+unless(true);`,
+			`macro "unless" (defined at 1:14) called at 2:1: wrong number of arguments: expected 3, got 1`,
+		},
+		{
+			`let notQuote = macro() { 1 };
+notQuote();`,
+			`macro "notQuote" (defined at 1:16) called at 2:1: macro must return a quoted AST node, got INTEGER`,
+		},
+		{
+			`let broken = macro(x) { x + 1 };
+broken(2);`,
+			`macro "broken" (defined at 1:14) called at 2:1: type mismatch: QUOTE + INTEGER`,
+		},
+		{
+			`let inner = macro(x) { quote(unquote(x)) };
+let outer = macro() { quote(inner()) };
+
+outer();`,
+			`macro "inner" (defined at 1:13) called at 2:29: wrong number of arguments: expected 1, got 0
+	in expansion of macro "outer" (defined at 2:13) called at 4:1`,
+		},
+		{
+			`let forever = macro() { quote(forever()) };
+forever();`,
+			"expansion exceeded the maximum depth of 64",
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+
+		DefineMacros(program, env)
+		_, err := ExpandMacros(program, env)
+
+		var macroErr *MacroError
+		if !errors.As(err, &macroErr) {
+			t.Errorf("expected *MacroError, got %T (%v)", err, err)
+			continue
+		}
+
+		if got := macroErr.Error(); !strings.Contains(got, tt.expectedError) {
+			t.Errorf("wrong error.\nwant %q\ngot  %q", tt.expectedError, got)
+		}
+	}
+}
+
+func TestExpandMacroErrorTrace(t *testing.T) {
+	input := `let inner = macro() { quote(1 + true) };
+let middle = macro() { quote(inner(1)) };
+let outer = macro() { quote(middle()) };
+outer();`
+
+	program := testParseProgram(input)
+	env := object.NewEnvironment()
+
+	DefineMacros(program, env)
+	_, err := ExpandMacros(program, env)
+
+	var macroErr *MacroError
+	if !errors.As(err, &macroErr) {
+		t.Fatalf("expected *MacroError, got %T (%v)", err, err)
+	}
+
+	expected := []string{"outer", "middle", "inner"}
+
+	if len(macroErr.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want %d, got %d", len(expected), len(macroErr.Trace))
+	}
+
+	for i, name := range expected {
+		if macroErr.Trace[i].Name != name {
+			t.Errorf("trace[%d] wrong. want %q, got %q", i, name, macroErr.Trace[i].Name)
+		}
+	}
+}
+
+func TestHygienicMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`let tmp = 1;
+let withTen = macro(body) { quote(fn(tmp) { unquote(body) + tmp }(10)) };
+withTen(tmp);`,
+			11,
+		},
+		{
+			`let x = 1;
+let plusFive = macro(e) { quote(fn() { let x = 5; unquote(e) + x }()) };
+plusFive(x);`,
+			6,
+		},
+		{
+			`let x__1 = 100;
+let plusFive = macro(e) { quote(fn() { let x = 5; unquote(e) + x }()) };
+plusFive(x__1);`,
+			105,
+		},
+		{
+			`let tmp = 1;
+let withTen = macro(body) { unhygienic(quote(fn(tmp) { unquote(body) + tmp }(10))) };
+withTen(tmp);`,
+			20,
+		},
+		{
+			`let x = 10;
+let m = macro() { quote(x + fn() { let x = 5; x }()) };
+m();`,
+			15,
+		},
+		{
+			`let y = 1;
+let m = macro(e) { quote(fn(y) { fn() { let y = unquote(e); y }() + y }(2)) };
+m(y + 10);`,
+			13,
+		},
+		{
+			`let m = {"x": 3};
+let getX = macro(obj) { quote(fn(x) { unquote(obj).x + x }(1)) };
+getX(m);`,
+			4,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		macroEnv := object.NewEnvironment()
+
+		DefineMacros(program, macroEnv)
+		expanded, err := ExpandMacros(program, macroEnv)
+		if err != nil {
+			t.Fatalf("unexpected error expanding macros: %v", err)
+		}
+
+		testIntegerObject(t, Eval(expanded, object.NewEnvironment()), tt.expected)
+	}
+}
+
+func TestGensym(t *testing.T) {
+	first := testEval(`gensym("tmp")`)
+	second := testEval(`gensym("tmp")`)
+
+	firstQuote, ok := first.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote, got %T (%+v)", first, first)
+	}
+
+	secondQuote, ok := second.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote, got %T (%+v)", second, second)
+	}
+
+	if !strings.HasPrefix(firstQuote.Node.String(), "tmp#") {
+		t.Errorf("expected name prefixed with %q, got %q", "tmp#", firstQuote.Node.String())
+	}
+
+	if firstQuote.Node.String() == secondQuote.Node.String() {
+		t.Errorf("expected fresh names, got %q twice", firstQuote.Node.String())
+	}
+
+	err, ok := testEval(`gensym(1)`).(*object.Error)
+	if !ok {
+		t.Fatalf("expected error for gensym(1)")
+	}
+
+	if err.Message != "argument to `gensym` not supported, got INTEGER" {
+		t.Errorf("wrong error message, got %q", err.Message)
+	}
+}
+
+func TestMacroExpand(t *testing.T) {
+	definitions := `
+let double = macro(x) { quote(unquote(x) * 2) };
+let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"macroexpand(quote(quadruple(1)))", "((1 * 2) * 2)"},
+		{"macroexpand1(quote(quadruple(1)))", "double(double(1))"},
+		{"macroexpand1(quote(f(double(1))))", "f(double(1))"},
+		{"macroexpand(quote(f(double(1))))", "f((1 * 2))"},
+		{"let q = quote(double(1)); macroexpand(q); q", "double(1)"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(definitions + tt.input)
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote for %q, got %T (%+v)", tt.input, evaluated, evaluated)
+		}
+
+		if got := quote.Node.String(); got != tt.expected {
+			t.Errorf("not equal. want %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestMacroExpandErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"macroexpand(1)",
+			"argument to `macroexpand` not supported, got INTEGER",
+		},
+		{
+			"macroexpand1(quote(1), quote(2))",
+			"wrong number of arguments: expected 1, got 2",
+		},
+		{
+			"let m = macro(x) { 1 }; macroexpand1(quote(m(1)))",
+			`macro "m" (defined at 1:9) called at 1:44: macro must return a quoted AST node, got INTEGER`,
+		},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("expected *object.Error for %q", tt.input)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message.\nwant %q\ngot  %q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
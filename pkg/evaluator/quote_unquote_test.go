@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/estevesnp/dsb/pkg/object"
@@ -117,6 +118,30 @@ func TestQuoteUnquote(t *testing.T) {
 		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
 			"(8 + (4 + 4))",
 		},
+		{
+			"quote(f(unquote(1 + 1), [unquote(2 * 2)]))",
+			"f(2, [4])",
+		},
+		{
+			"quote(unquote(1 + 1).x)",
+			"(2.x)",
+		},
+		{
+			"let q = fn(x) { quote(unquote(x) + 1) }; q(1); q(2)",
+			"(2 + 1)",
+		},
+		{
+			`quote(unquote({"a": null, "b": [1, {2}]}))`,
+			"{a:null, b:[1, {2}]}",
+		},
+		{
+			"quote(unquote(set()))",
+			"set()",
+		},
+		{
+			"quote(unquote([quote(x), quote(1 + 1)]))",
+			"[x, (1 + 1)]",
+		},
 	}
 
 	for _, tt := range tests {
@@ -136,3 +161,109 @@ func TestQuoteUnquote(t *testing.T) {
 		}
 	}
 }
+
+func TestQuoteUnquoteSplice(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let args = [quote(a), quote(b)]; quote(f(unquote_splice(args)))",
+			"f(a, b)",
+		},
+		{
+			"let args = [quote(a), quote(b)]; quote(f(x, unquote_splice(args), y))",
+			"f(x, a, b, y)",
+		},
+		{
+			"quote(f(unquote_splice([])))",
+			"f()",
+		},
+		{
+			"quote([0, unquote_splice([1, 2]), 3])",
+			"[0, 1, 2, 3]",
+		},
+		{
+			"quote({0, unquote_splice([1, 2])})",
+			"{0, 1, 2}",
+		},
+		{
+			"let body = [quote(a), quote(b + 1)]; quote(fn() { unquote_splice(body); c })",
+			"fn() a(b + 1)c",
+		},
+		{
+			"let xs = [quote(y)]; quote(f(unquote(len(xs)), unquote_splice(xs)))",
+			"f(1, y)",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote, got %T (%+v)", evaluated, evaluated)
+		}
+
+		if got := quote.Node.String(); got != tt.expected {
+			t.Errorf("not equal. got %q, want %q", got, tt.expected)
+		}
+	}
+}
+
+func TestQuoteUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"quote(unquote(len))",
+			"cannot convert BUILTIN to an AST node",
+		},
+		{
+			"quote(unquote(1 + true))",
+			"type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			"quote(f(unquote_splice(1)))",
+			"unquote_splice expects an array, got INTEGER",
+		},
+		{
+			"quote(1 + unquote_splice([1]))",
+			"unquote_splice can only be used inside arguments, arrays, sets and blocks",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("expected *object.Error for %q, got %T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. want %q, got %q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestAstBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"astKind(quote(1 + 2))", "InfixExpression"},
+		{"astKind(quote(f(x)))", "CallExpression"},
+		{"astKind(quote(x))", "Identifier"},
+		{"len(astChildren(quote(f(x, y))))", 3},
+		{"astKind(first(astChildren(quote(-x))))", "Identifier"},
+		{"len(astChildren(quote(1)))", 0},
+		{"astKind(1)", errors.New("argument to `astKind` not supported, got INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testExpectedObject(t, testEval(tt.input), tt.expected)
+	}
+}
@@ -0,0 +1,149 @@
+package evaluator
+
+import (
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+// defaultMaxDepth is how many function calls can be nested before
+// evaluation fails with a stack overflow error, instead of exhausting Go's
+// stack, unless the run's limits set MaxDepth. Tail calls don't nest, so
+// they don't count towards it.
+const defaultMaxDepth = 10_000
+
+const tailCallObj object.ObjectType = "TAIL_CALL"
+
+// tailCall is a call made in tail position. Instead of calling the function
+// right away, it's handed back to applyFunction, which runs it in place of
+// the call that's returning, so a loop written as recursion runs in constant
+// Go stack.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType {
+	return tailCallObj
+}
+
+func (tc *tailCall) Inspect() string {
+	return "tail call to " + tc.fn.Inspect()
+}
+
+// evalTail evaluates node, which is in tail position in a function's body:
+// it's the last thing evaluated before the function returns, or the value
+// of a return statement. A call there comes back as a tailCall.
+func (ev *Evaluator) evalTail(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	case *ast.ReturnStatement:
+		return ev.evalTailReturn(node, env)
+
+	case *ast.BlockStatement:
+		return ev.evalTailBlockStatement(node, env)
+
+	case *ast.ExpressionStatement:
+		return ev.evalTail(node.Expression, env)
+
+	case *ast.IfExpression:
+		condition := ev.Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return ev.evalTail(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return ev.evalTail(node.Alternative, env)
+		} else {
+			return NULL
+		}
+
+	case *ast.CallExpression:
+		return ev.evalCallExpression(node, env, true)
+
+	default:
+		return ev.Eval(node, env)
+	}
+}
+
+func (ev *Evaluator) evalTailBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	if len(block.Statements) == 0 {
+		return NULL
+	}
+
+	last := len(block.Statements) - 1
+
+	for _, statement := range block.Statements[:last] {
+		result := ev.evalReturning(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return ev.evalTail(block.Statements[last], env)
+}
+
+// evalReturning evaluates node, a statement of a function's body, or of an
+// if in statement position in it, which isn't in tail position but whose
+// return statements return from the function. Only those can return a
+// tailCall, a return nested in an expression leaves its value there.
+func (ev *Evaluator) evalReturning(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+
+	case *ast.ReturnStatement:
+		return ev.evalTailReturn(node, env)
+
+	case *ast.ExpressionStatement:
+		if ifExp, ok := node.Expression.(*ast.IfExpression); ok {
+			return ev.evalReturning(ifExp, env)
+		}
+		return ev.Eval(node, env)
+
+	case *ast.BlockStatement:
+		var result object.Object = NULL
+
+		for _, statement := range node.Statements {
+			result = ev.evalReturning(statement, env)
+
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+					return result
+				}
+			}
+		}
+
+		return result
+
+	case *ast.IfExpression:
+		condition := ev.Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+
+		if isTruthy(condition) {
+			return ev.evalReturning(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return ev.evalReturning(node.Alternative, env)
+		} else {
+			return NULL
+		}
+
+	default:
+		return ev.Eval(node, env)
+	}
+}
+
+func (ev *Evaluator) evalTailReturn(node *ast.ReturnStatement, env *object.Environment) object.Object {
+	val := ev.evalTail(node.ReturnValue, env)
+	if isError(val) {
+		return val
+	}
+
+	return &object.ReturnValue{Value: val}
+}
@@ -1,36 +1,361 @@
 package interpreter
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/compiler"
 	"github.com/estevesnp/dsb/pkg/evaluator"
 	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/limits"
 	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/optimizer"
 	"github.com/estevesnp/dsb/pkg/parser"
+	"github.com/estevesnp/dsb/pkg/resolver"
+	"github.com/estevesnp/dsb/pkg/token"
+	"github.com/estevesnp/dsb/pkg/vm"
 )
 
-func Start(reader io.Reader) error {
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("error loading program: %w", err)
+type ParseError struct {
+	Errors []string
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("error parsing program:\n\t%s", strings.Join(pe.Errors, "\n\t"))
+}
+
+type MacroError struct {
+	Err error
+}
+
+func (me *MacroError) Error() string {
+	return fmt.Sprintf("error expanding macros: %s", me.Err)
+}
+
+func (me *MacroError) Unwrap() error {
+	return me.Err
+}
+
+type EvalError struct {
+	Message string
+	Pos     token.Position
+
+	// Err is what caused the error, if it didn't come from the program
+	// itself, like ctx.Err() or one of the errors in the limits package.
+	Err error
+}
+
+func (ee *EvalError) Error() string {
+	if ee.Pos.IsValid() {
+		return fmt.Sprintf("error evaluating the program at %s: %s", ee.Pos, ee.Message)
+	}
+
+	return fmt.Sprintf("error evaluating the program: %s", ee.Message)
+}
+
+func (ee *EvalError) Unwrap() error {
+	return ee.Err
+}
+
+type CompileError struct {
+	Err error
+}
+
+func (ce *CompileError) Error() string {
+	return fmt.Sprintf("error compiling the program: %s", ce.Err)
+}
+
+func (ce *CompileError) Unwrap() error {
+	return ce.Err
+}
+
+// Backend selects what runs a program once its macros are expanded.
+type Backend string
+
+const (
+	// EvaluatorBackend walks the AST directly.
+	EvaluatorBackend Backend = "eval"
+	// VMBackend compiles the program to bytecode and runs it on the VM.
+	VMBackend Backend = "vm"
+)
+
+func ParseBackend(name string) (Backend, error) {
+	switch backend := Backend(name); backend {
+	case EvaluatorBackend, VMBackend:
+		return backend, nil
+	default:
+		return "", fmt.Errorf("unknown backend %q, expected %q or %q", name, EvaluatorBackend, VMBackend)
+	}
+}
+
+// Interpreter runs programs through the full pipeline: lex, parse, define
+// macros, expand them and evaluate. Globals and macros persist between runs,
+// so a macro defined by one input can be used by the next.
+type Interpreter struct {
+	backend  Backend
+	optimize bool
+	limits   limits.Limits
+
+	runtime   *object.Runtime
+	evaluator *evaluator.Evaluator
+	env       *object.Environment
+	macroEnv  *object.Environment
+	resolver  *resolver.Resolver
+
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+
+	// builtinsDefined is how many of the runtime's builtins the resolver
+	// and the symbol table know about.
+	builtinsDefined int
+}
+
+// New returns an Interpreter using the evaluator. macroexpand sees the
+// macros defined so far, on either backend.
+func New() *Interpreter {
+	return NewWithBackend(EvaluatorBackend)
+}
+
+func NewWithBackend(backend Backend) *Interpreter {
+	macroEnv := object.NewEnvironment()
+	runtime := object.NewRuntime()
+
+	interp := &Interpreter{
+		backend:   backend,
+		runtime:   runtime,
+		evaluator: evaluator.New(runtime),
+		env:       object.NewEnclosedEnvironment(macroEnv),
+		macroEnv:  macroEnv,
+		resolver:  resolver.New(),
+	}
+
+	runtime.Expand = func(ctx context.Context, node ast.Node, all bool) (ast.Node, error) {
+		return interp.evaluator.MacroExpandContext(ctx, node, interp.macroEnv, all, interp.limits)
+	}
+
+	if backend == VMBackend {
+		interp.symbolTable = compiler.NewSymbolTable()
+		interp.globals = make([]object.Object, vm.GlobalsSize)
+	}
+
+	interp.defineBuiltins()
+
+	return interp
+}
+
+// defineBuiltins tells the resolver and the symbol table about the
+// functions and modules registered on the runtime since it was last called.
+func (i *Interpreter) defineBuiltins() {
+	names := i.runtime.BuiltinNames()
+
+	for idx, name := range names[i.builtinsDefined:] {
+		idx += i.builtinsDefined
+
+		i.resolver.DeclareBuiltin(name)
+		if i.symbolTable != nil {
+			i.symbolTable.DefineBuiltin(idx, name)
+		}
 	}
 
-	l := lexer.New(string(data))
+	i.builtinsDefined = len(names)
+}
+
+// Runtime returns the Runtime programs run by i use, to set where their
+// output goes before running them.
+func (i *Interpreter) Runtime() *object.Runtime {
+	return i.runtime
+}
+
+// Expand parses input, defines its macros and returns the program with every
+// macro call expanded, without evaluating it.
+func (i *Interpreter) Expand(input string) (*ast.Program, error) {
+	return i.expand(context.Background(), input)
+}
+
+// expand is Expand with the macros run under ctx and the limits of i.
+func (i *Interpreter) expand(ctx context.Context, input string) (*ast.Program, error) {
+	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	if errs := p.Errors(); len(errs) != 0 {
-		return fmt.Errorf("error parsing program:\n\t%s", strings.Join(errs, "\n\t"))
+		return nil, &ParseError{Errors: errs}
+	}
+
+	evaluator.DefineMacros(program, i.macroEnv)
+	expanded, err := i.evaluator.ExpandMacrosContext(ctx, program, i.macroEnv, i.limits)
+	if err != nil {
+		return nil, &MacroError{Err: err}
 	}
 
-	env := object.NewEnvironment()
+	return expanded.(*ast.Program), nil
+}
 
-	res := evaluator.Eval(program, env)
-	if err, ok := res.(*object.Error); ok {
-		return fmt.Errorf("error evaluating the program: %s", err.Message)
+// SetOptimize turns the optimizer on or off for the programs run or
+// compiled from then on.
+func (i *Interpreter) SetOptimize(optimize bool) {
+	i.optimize = optimize
+}
+
+// expandAndOptimize expands input and, if enabled, optimizes it, ready to be
+// run or compiled.
+func (i *Interpreter) expandAndOptimize(ctx context.Context, input string) (*ast.Program, error) {
+	expanded, err := i.expand(ctx, input)
+	if err != nil || !i.optimize {
+		return expanded, err
+	}
+
+	optimized, err := optimizer.Optimize(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("error optimizing the program: %w", err)
+	}
+
+	return optimized, nil
+}
+
+// SetLimits bounds every run from then on by lim, along with the macros
+// expanded before it.
+func (i *Interpreter) SetLimits(lim limits.Limits) {
+	i.limits = lim
+}
+
+func (i *Interpreter) Run(input string) (object.Object, error) {
+	return i.RunContext(context.Background(), input)
+}
+
+// RunContext runs input like Run, stopping with an *EvalError wrapping
+// ctx.Err() once ctx is done, or a *MacroError if that's while expanding
+// its macros.
+func (i *Interpreter) RunContext(ctx context.Context, input string) (object.Object, error) {
+	program, err := i.prepare(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.RunContext(ctx)
+}
+
+// Check parses input and expands its macros like Run, then reports its
+// undefined identifiers and unused bindings without running it.
+func (i *Interpreter) Check(input string) ([]resolver.Diagnostic, error) {
+	expanded, err := i.Expand(input)
+	if err != nil {
+		return nil, err
+	}
+
+	i.defineBuiltins()
+	return i.resolver.Resolve(expanded), nil
+}
+
+// RunBytecode runs an already compiled program, like one loaded from a
+// .dsbc file, on a fresh VM. It does not share globals with other runs.
+func (i *Interpreter) RunBytecode(bytecode *compiler.Bytecode) (object.Object, error) {
+	if err := i.checkBuiltins(bytecode.Builtins); err != nil {
+		return nil, err
+	}
+
+	machine := vm.New(bytecode)
+	machine.SetRuntime(i.runtime)
+	machine.SetLimits(context.Background(), i.limits)
+
+	return runBytecode(machine)
+}
+
+// checkBuiltins returns an error unless the runtime has the builtins a
+// program was compiled against at the same indexes, since that's how the
+// program refers to them. Builtins registered after those don't matter.
+func (i *Interpreter) checkBuiltins(names []string) error {
+	have := i.runtime.BuiltinNames()
+
+	if len(names) > len(have) {
+		return fmt.Errorf("compiled program needs %d builtins, the runtime has %d, rebuild it or register the functions it was built with", len(names), len(have))
+	}
+
+	for idx, name := range names {
+		if have[idx] != name {
+			return fmt.Errorf("compiled program expects builtin %d to be %s, the runtime's is %s, rebuild it", idx, name, have[idx])
+		}
 	}
 
 	return nil
 }
+
+// Compile parses input, expands its macros and compiles it to bytecode,
+// ready to be saved and run later with RunBytecode.
+func (i *Interpreter) Compile(input string) (*compiler.Bytecode, error) {
+	expanded, err := i.expandAndOptimize(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	symbolTable := compiler.NewSymbolTable()
+	for idx, name := range i.runtime.BuiltinNames() {
+		symbolTable.DefineBuiltin(idx, name)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(expanded); err != nil {
+		return nil, &CompileError{Err: err}
+	}
+
+	return comp.Bytecode(), nil
+}
+
+func runBytecode(machine *vm.VM) (object.Object, error) {
+	if err := machine.Run(); err != nil {
+		return vmError(err)
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}
+
+// vmError turns an error from the VM into an *EvalError, returning it along
+// with the *object.Error the evaluator would have returned.
+func vmError(err error) (object.Object, error) {
+	evalErr := &EvalError{Message: err.Error()}
+
+	var runtimeErr *vm.RuntimeError
+	if errors.As(err, &runtimeErr) {
+		evalErr.Pos = runtimeErr.Pos
+		evalErr.Err = runtimeErr.Err
+	}
+
+	return &object.Error{Message: evalErr.Message, Err: evalErr.Err}, evalErr
+}
+
+// evalResult returns res along with an *EvalError if it's an error.
+func evalResult(res object.Object) (object.Object, error) {
+	if err, ok := res.(*object.Error); ok {
+		return res, &EvalError{Message: err.Message, Err: err.Err}
+	}
+
+	return res, nil
+}
+
+func (i *Interpreter) RunReader(reader io.Reader) (object.Object, error) {
+	return i.runReader(context.Background(), reader)
+}
+
+func (i *Interpreter) runReader(ctx context.Context, reader io.Reader) (object.Object, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error loading program: %w", err)
+	}
+
+	return i.RunContext(ctx, string(data))
+}
+
+// Start runs the program read from reader on a new Interpreter, bounded by
+// ctx and lim.
+func Start(ctx context.Context, reader io.Reader, lim limits.Limits) error {
+	interp := New()
+	interp.SetLimits(lim)
+
+	_, err := interp.runReader(ctx, reader)
+	return err
+}
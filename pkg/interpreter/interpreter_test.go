@@ -0,0 +1,353 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/resolver"
+)
+
+func TestRunExpandsMacros(t *testing.T) {
+	input := `
+let unless = macro(condition, consequence, alternative) {
+    quote(if (!(unquote(condition))) {
+        unquote(consequence);
+    } else {
+        unquote(alternative);
+    });
+};
+
+unless(10 > 5, 1, 2);`
+
+	res, err := New().Run(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testInteger(t, res, 2)
+}
+
+func TestHygieneRenamesOnlyInScope(t *testing.T) {
+	input := "let x = 10; let m = macro() { quote(x + fn() { let x = 5; x }()) }; m()"
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		res, err := NewWithBackend(backend).Run(input)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		testInteger(t, res, 15)
+	}
+}
+
+func TestMacrosPersistAcrossRuns(t *testing.T) {
+	interp := New()
+
+	if _, err := interp.Run("let double = macro(x) { quote(unquote(x) * 2) };"); err != nil {
+		t.Fatalf("unexpected error defining macro: %v", err)
+	}
+
+	res, err := interp.Run("double(21)")
+	if err != nil {
+		t.Fatalf("unexpected error using macro: %v", err)
+	}
+
+	testInteger(t, res, 42)
+}
+
+func TestStartExpandsMacros(t *testing.T) {
+	input := `
+let assert = macro(cond) { quote(if (unquote(cond)) { null } else { 1 + true }) };
+let x = 5;
+assert(x < 1);`
+
+	err := Start(context.Background(), strings.NewReader(input), limits.Limits{})
+
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("expected *EvalError, got %T (%v)", err, err)
+	}
+
+	if expected := "type mismatch: INTEGER + BOOLEAN"; evalErr.Message != expected {
+		t.Errorf("wrong error message. want %q, got %q", expected, evalErr.Message)
+	}
+}
+
+func TestRunParseError(t *testing.T) {
+	_, err := New().Run("let = 5;")
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("expected *ParseError, got %T (%v)", err, err)
+	}
+
+	if n := len(parseErr.Errors); n == 0 {
+		t.Errorf("parse error has no messages")
+	}
+}
+
+func testInteger(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+
+	integer, ok := obj.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got %T (%+v)", obj, obj)
+	}
+
+	if integer.Value != expected {
+		t.Errorf("object has wrong value. got %d, want %d", integer.Value, expected)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	input := `
+let double = macro(x) { quote(unquote(x) * 2) };
+let y = double(1 + 1);
+print(quote(double(y)));`
+
+	program, err := New().Expand(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "let y = ((1 + 1) * 2);print(quote(double(y)))"
+	if got := program.String(); got != expected {
+		t.Errorf("wrong expansion. want %q, got %q", expected, got)
+	}
+}
+
+func TestMacroExpandAtRunTime(t *testing.T) {
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		if _, err := interp.Run("let double = macro(x) { quote(unquote(x) * 2) };"); err != nil {
+			t.Fatalf("unexpected error defining macro with the %s backend: %v", backend, err)
+		}
+
+		res, err := interp.Run("let expand = macroexpand; [macroexpand(quote(double(3))), expand(quote(double(4)))]")
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		if got := res.Inspect(); got != "[QUOTE((3 * 2)), QUOTE((4 * 2))]" {
+			t.Errorf("wrong expansion with the %s backend. want %q, got %q", backend, "[QUOTE((3 * 2)), QUOTE((4 * 2))]", got)
+		}
+	}
+}
+
+func TestVMBackend(t *testing.T) {
+	interp := NewWithBackend(VMBackend)
+
+	if _, err := interp.Run("let double = macro(x) { quote(unquote(x) * 2) }; let base = 20;"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	res, err := interp.Run("let add = fn(a) { base + a }; add(double(1))")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testInteger(t, res, 22)
+
+	_, err = interp.Run("add(true)")
+
+	var evalErr *EvalError
+	if !errors.As(err, &evalErr) {
+		t.Fatalf("expected *EvalError, got %T (%v)", err, err)
+	}
+
+	if evalErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message, got %q", evalErr.Message)
+	}
+
+	_, err = interp.Run("quote(1, 2)")
+
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("expected *CompileError, got %T (%v)", err, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	interp := New()
+
+	diagnostics, err := interp.Check("let m = macro(x) { quote(unquote(x) + y) }; let f = fn(a) { m(a) }; f(1)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. want 1, got %v", diagnostics)
+	}
+
+	if got := diagnostics[0]; got.Kind != resolver.Undefined || got.Name != "y" {
+		t.Errorf("wrong diagnostic, got %s", got)
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	input := `
+let day = 60 * 60 * 24;
+let f = fn(n) { if (true) { let k = 2; return n * k * day; 0 } };
+let x = if (1 > 2) { 1 } else { f(3) };
+x`
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+		interp.SetOptimize(true)
+
+		res, err := interp.Run(input)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		testInteger(t, res, 518400)
+
+		_, err = interp.Run("x + (1 - 1 == 0)")
+
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) {
+			t.Fatalf("expected *EvalError, got %T (%v)", err, err)
+		}
+
+		if evalErr.Message != "type mismatch: INTEGER + BOOLEAN" {
+			t.Errorf("wrong error message with the %s backend, got %q", backend, evalErr.Message)
+		}
+	}
+}
+
+func TestParseBackend(t *testing.T) {
+	for _, name := range []string{"eval", "vm"} {
+		if _, err := ParseBackend(name); err != nil {
+			t.Errorf("unexpected error for %q: %v", name, err)
+		}
+	}
+
+	if _, err := ParseBackend("jit"); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   limits.Limits
+		expected error
+	}{
+		{"let f = fn() { f() + 1 }; f()", limits.Limits{}, limits.ErrDepth},
+		{"let f = fn(n) { f(n + 1) + 1 }; f(0)", limits.Limits{MaxDepth: 100}, limits.ErrDepth},
+		{"let loop = fn(n) { if (n > 0) { loop(n - 1) } }; loop(100000)", limits.Limits{MaxSteps: 1000}, limits.ErrSteps},
+		{`let grow = fn(s) { grow(s + s) }; grow("a")`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{"let x = 1.5; x + x + x + x + x", limits.Limits{MaxAlloc: 48}, limits.ErrAlloc},
+		{`strings.repeat("a", 1000000000000)`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{`strings.padLeft("a", 1000000000000)`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{`let s = strings.repeat("a", 20000); strings.replace(s, "", s)`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{`let s = strings.repeat("a", 20000); strings.join(strings.split(s, ""), s)`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{`strings.split(strings.repeat("a", 100000), "")`, limits.Limits{MaxAlloc: 1 << 20}, limits.ErrAlloc},
+		{`format("%1000000d", 1)`, limits.Limits{MaxAlloc: 1 << 10}, limits.ErrAlloc},
+		{"let x = 1.5; -(-(-(-x)))", limits.Limits{MaxAlloc: 48}, limits.ErrAlloc},
+		{"let m = macro() { let f = fn(x) { f(x) }; f(1) }; m()", limits.Limits{MaxSteps: 10000}, limits.ErrSteps},
+		{"let m = macro() { let f = fn(x) { f(x) + 1 }; f(1) }; m()", limits.Limits{MaxDepth: 100}, limits.ErrDepth},
+		{"let m = macro() { let f = fn(x) { f(x) }; f(1) }; macroexpand(quote(m()))", limits.Limits{MaxSteps: 10000}, limits.ErrSteps},
+	}
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		for _, tt := range tests {
+			interp := NewWithBackend(backend)
+			interp.SetLimits(tt.limits)
+
+			_, err := interp.Run(tt.input)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("wrong error for %q with the %s backend. want %v, got %v", tt.input, backend, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestLimitsLeaveShortProgramsAlone(t *testing.T) {
+	lim := limits.Limits{MaxSteps: 1000, MaxDepth: 10, MaxAlloc: 1 << 10}
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+		interp.SetLimits(lim)
+
+		res, err := interp.Run("let f = fn(n) { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; f(5)")
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		testInteger(t, res, 5)
+	}
+}
+
+func TestRunContextCancellation(t *testing.T) {
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+		_, err := NewWithBackend(backend).RunContext(ctx, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(40)")
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wrong error with the %s backend. want %v, got %v", backend, context.DeadlineExceeded, err)
+		}
+	}
+}
+
+func TestRunContextCancelsMacros(t *testing.T) {
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+
+		_, err := NewWithBackend(backend).RunContext(ctx, "let m = macro() { let f = fn(x) { f(x) }; f(1) }; m()")
+		cancel()
+
+		var macroErr *MacroError
+		if !errors.As(err, &macroErr) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("wrong error with the %s backend. want a *MacroError wrapping %v, got %v", backend, context.DeadlineExceeded, err)
+		}
+	}
+}
+
+func TestConcurrentInterpreters(t *testing.T) {
+	input := `
+let double = macro(x) { quote(fn(t) { t * 2 }(unquote(x))) };
+let sum = fn(xs) { if (len(xs) == 0) { 0 } else { first(xs) + sum(tail(xs)) } };
+let total = double(len(set(["a", "b", "a"])) + sum([1, 2, 3]));
+println(total);
+total`
+
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var out bytes.Buffer
+				interp := NewWithBackend(backend)
+				interp.Runtime().Stdout = &out
+
+				res, err := interp.Run(input)
+				if err != nil {
+					t.Errorf("unexpected error with the %s backend: %v", backend, err)
+					return
+				}
+
+				if integer, ok := res.(*object.Integer); !ok || integer.Value != 16 {
+					t.Errorf("wrong result with the %s backend. want 16, got %v", backend, res)
+				}
+
+				if got := out.String(); got != "16\n" {
+					t.Errorf("wrong output with the %s backend. want %q, got %q", backend, "16\n", got)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,73 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreams(t *testing.T) {
+	input := `
+let name = input("name? ");
+let age = readLine();
+print("hello", name);
+println("!");
+printf("%s is %d%%", age, 100);
+eprint("done", 1);
+eprintln("!");
+[readLine(), readLine()]`
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		var stdout, stderr strings.Builder
+
+		interp := NewWithBackend(backend)
+		rt := interp.Runtime()
+		rt.Stdout = &stdout
+		rt.Stderr = &stderr
+		rt.Stdin = strings.NewReader("ana\r\n30\nlast")
+
+		res, err := interp.Run(input)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		if expected := "name? hello ana!\n30 is 100%"; stdout.String() != expected {
+			t.Errorf("wrong stdout with the %s backend. want %q, got %q", backend, expected, stdout.String())
+		}
+
+		if expected := "done 1!\n"; stderr.String() != expected {
+			t.Errorf("wrong stderr with the %s backend. want %q, got %q", backend, expected, stderr.String())
+		}
+
+		if expected := "[last, null]"; res.Inspect() != expected {
+			t.Errorf("wrong result with the %s backend. want %q, got %q", backend, expected, res.Inspect())
+		}
+	}
+}
+
+func TestPrintfErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`printf()`, "wrong number of arguments: expected at least 1, got 0"},
+		{`printf(1)`, "argument to `printf` must be STRING, got INTEGER"},
+		{`printf("%d", "a")`, `format "%d": %d needs an INTEGER, got STRING`},
+		{`printf("%s")`, `format "%s": missing argument for %s`},
+		{`printf("x", 1)`, `format "x": 1 argument left over`},
+		{`readLine(1)`, "wrong number of arguments: expected 0, got 1"},
+	}
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+		interp.Runtime().Stdout = &strings.Builder{}
+
+		for _, tt := range tests {
+			_, err := interp.Run(tt.input)
+
+			evalErr, ok := err.(*EvalError)
+			if !ok || evalErr.Message != tt.expected {
+				t.Errorf("wrong error for %s with the %s backend. want %q, got %v", tt.input, backend, tt.expected, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestRegisterFunc(t *testing.T) {
+	errNotFound := errors.New("not found")
+
+	tests := []struct {
+		input    string
+		expected string
+		err      string
+	}{
+		{`add(2, 3)`, "5", ""},
+		{`join("-", "a", "b", "c")`, "a-b-c", ""},
+		{`join("-")`, "", ""},
+		{`greeting()`, "hello from ctx", ""},
+		{`lookup("ana")`, "30", ""},
+		{`lookup("bob")`, "", "not found"},
+		{`add(1)`, "", "wrong number of arguments: expected 2, got 1"},
+		{`add(1, "a")`, "", "argument 2 to `add` not supported: cannot convert STRING to int"},
+		{`join()`, "", "wrong number of arguments: expected at least 1, got 0"},
+		{`len("abc")`, "3", ""},
+		{`first([])`, "", "panic in `first`: runtime error: index out of range [0] with length 0"},
+	}
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+		rt := interp.Runtime()
+
+		mustRegister(t, rt.RegisterFunc("add", func(a, b int) int { return a + b }))
+		mustRegister(t, rt.RegisterFunc("join", func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		}))
+		mustRegister(t, rt.RegisterFunc("greeting", func(ctx context.Context) string {
+			return fmt.Sprint(ctx.Value(ctxKey{}))
+		}))
+		mustRegister(t, rt.RegisterFunc("lookup", func(name string) (int, error) {
+			if name == "ana" {
+				return 30, nil
+			}
+			return 0, errNotFound
+		}))
+
+		mustRegister(t, rt.RegisterFunc("first", func(values []int) int { return values[0] }))
+
+		ctx := context.WithValue(context.Background(), ctxKey{}, "hello from ctx")
+
+		for _, tt := range tests {
+			res, err := interp.RunContext(ctx, tt.input)
+
+			if tt.err != "" {
+				var evalErr *EvalError
+				if !errors.As(err, &evalErr) || evalErr.Message != tt.err {
+					t.Errorf("wrong error for %q with the %s backend. want %q, got %v", tt.input, backend, tt.err, err)
+				}
+				if tt.err == "not found" && !errors.Is(err, errNotFound) {
+					t.Errorf("expected error for %q with the %s backend to wrap errNotFound", tt.input, backend)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error for %q with the %s backend: %v", tt.input, backend, err)
+				continue
+			}
+
+			if res.Inspect() != tt.expected {
+				t.Errorf("wrong result for %q with the %s backend. want %q, got %q", tt.input, backend, tt.expected, res.Inspect())
+			}
+		}
+	}
+}
+
+func TestRegisterModule(t *testing.T) {
+	input := `db.query("users", 2) + " from " + db.name`
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		err := interp.Runtime().RegisterModule("db", map[string]any{
+			"name": "main",
+			"query": func(table string, limit int) string {
+				return fmt.Sprintf("%d rows of %s", limit, table)
+			},
+		})
+		mustRegister(t, err)
+
+		res, err := interp.Run(input)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		if expected := `2 rows of users from main`; res.Inspect() != expected {
+			t.Errorf("wrong result with the %s backend. want %q, got %q", backend, expected, res.Inspect())
+		}
+
+		diagnostics, err := interp.Check(`db.name`)
+		if err != nil || len(diagnostics) != 0 {
+			t.Errorf("expected db to be defined with the %s backend, got %v (%v)", backend, diagnostics, err)
+		}
+	}
+}
+
+func TestRegisterAfterRun(t *testing.T) {
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		if _, err := interp.Run(`let x = 1;`); err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		mustRegister(t, interp.Runtime().RegisterFunc("double", func(n int) int { return n * 2 }))
+
+		res, err := interp.Run(`double(x + 1)`)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		if res.Inspect() != "4" {
+			t.Errorf("wrong result with the %s backend. want 4, got %s", backend, res.Inspect())
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	rt := NewWithBackend(EvaluatorBackend).Runtime()
+
+	if err := rt.RegisterFunc("notFn", 1); err == nil {
+		t.Errorf("expected an error registering a non function")
+	}
+
+	if err := rt.RegisterFunc("tooMany", func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("expected an error registering a function returning two values")
+	}
+
+	if err := rt.RegisterModule("bad", map[string]any{"ch": make(chan int)}); err == nil {
+		t.Errorf("expected an error registering a module with a channel")
+	}
+}
+
+func mustRegister(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("unexpected error registering: %v", err)
+	}
+}
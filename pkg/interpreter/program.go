@@ -0,0 +1,152 @@
+package interpreter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/vm"
+)
+
+// Program is an input parsed, expanded and, for the VM, compiled once by
+// Prepare, that can then be run any number of times. Every run shares the
+// globals of the Interpreter that prepared it.
+type Program struct {
+	interp   *Interpreter
+	program  *ast.Program
+	bytecode *compiler.Bytecode
+}
+
+// Prepare does everything Run does to input except running it, so the
+// returned Program can be run many times without parsing it again. Macros
+// it defines can be used right away by later inputs.
+func (i *Interpreter) Prepare(input string) (*Program, error) {
+	return i.prepare(context.Background(), input)
+}
+
+// prepare is Prepare with the macros expanded under ctx.
+func (i *Interpreter) prepare(ctx context.Context, input string) (*Program, error) {
+	expanded, err := i.expandAndOptimize(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	i.defineBuiltins()
+
+	if i.backend != VMBackend {
+		i.resolver.Resolve(expanded)
+		return &Program{interp: i, program: expanded}, nil
+	}
+
+	comp := compiler.NewWithState(i.symbolTable, i.constants)
+	if err := comp.Compile(expanded); err != nil {
+		return nil, &CompileError{Err: err}
+	}
+
+	bytecode := comp.Bytecode()
+	i.constants = bytecode.Constants
+
+	return &Program{interp: i, bytecode: bytecode}, nil
+}
+
+func (p *Program) Run() (object.Object, error) {
+	return p.RunContext(context.Background())
+}
+
+// RunContext runs the program, stopping with an *EvalError wrapping
+// ctx.Err() once ctx is done.
+func (p *Program) RunContext(ctx context.Context) (object.Object, error) {
+	i := p.interp
+
+	if p.bytecode == nil {
+		return evalResult(i.evaluator.EvalContext(ctx, p.program, i.env, i.limits))
+	}
+
+	machine := vm.NewWithGlobalsStore(p.bytecode, i.globals)
+	machine.SetRuntime(i.runtime)
+	machine.SetLimits(ctx, i.limits)
+
+	return runBytecode(machine)
+}
+
+// Set defines the global name, converting value with object.FromGo, so
+// programs run from then on can use it.
+func (i *Interpreter) Set(name string, value any) error {
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return fmt.Errorf("error setting %s: %w", name, err)
+	}
+
+	if i.backend != VMBackend {
+		i.env.Set(name, obj)
+		i.resolver.Declare(name)
+		return nil
+	}
+
+	symbol := i.symbolTable.Define(name)
+	if symbol.Index >= len(i.globals) {
+		return fmt.Errorf("error setting %s: too many globals", name)
+	}
+	i.globals[symbol.Index] = obj
+
+	return nil
+}
+
+// Get returns the value of the global name, which object.ToGo converts to a
+// Go value.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	if i.backend != VMBackend {
+		return i.env.Get(name)
+	}
+
+	symbol, ok := i.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope || i.globals[symbol.Index] == nil {
+		return nil, false
+	}
+
+	return i.globals[symbol.Index], true
+}
+
+func (i *Interpreter) Call(name string, args ...any) (object.Object, error) {
+	return i.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls the function bound to the global name with args,
+// converted with object.FromGo. Like a run, the call can change globals,
+// and fails with an *EvalError if the function does.
+func (i *Interpreter) CallContext(ctx context.Context, name string, args ...any) (object.Object, error) {
+	fn, ok := i.Get(name)
+	if !ok {
+		return nil, &EvalError{Message: "identifier not found: " + name}
+	}
+
+	objects := make([]object.Object, len(args))
+	for idx, arg := range args {
+		obj, err := object.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("error calling %s: argument %d: %w", name, idx, err)
+		}
+		objects[idx] = obj
+	}
+
+	if i.backend != VMBackend {
+		return evalResult(i.evaluator.ApplyContext(ctx, fn, objects, i.limits))
+	}
+
+	// the function's code refers to constants by their index in the
+	// constants of every program compiled so far
+	bytecode := &compiler.Bytecode{Constants: i.constants, Globals: i.symbolTable.Global().Names()}
+
+	machine := vm.NewWithGlobalsStore(bytecode, i.globals)
+	machine.SetRuntime(i.runtime)
+	machine.SetLimits(ctx, i.limits)
+
+	res, err := machine.Call(fn, objects...)
+	if err != nil {
+		return vmError(err)
+	}
+
+	return res, nil
+}
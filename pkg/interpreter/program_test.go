@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+type user struct {
+	Name  string
+	Age   int
+	Roles []string `dsb:"roles"`
+}
+
+func TestPrepareRunsManyTimes(t *testing.T) {
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		program, err := interp.Prepare("let double = macro(x) { quote(unquote(x) * 2) }; double(base)")
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		for _, base := range []int{1, 2, 3} {
+			if err := interp.Set("base", base); err != nil {
+				t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+			}
+
+			res, err := program.Run()
+			if err != nil {
+				t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+			}
+
+			testInteger(t, res, int64(base*2))
+		}
+	}
+}
+
+func TestSetAndCall(t *testing.T) {
+	input := `
+let allowed = fn(user, role) {
+	let has = fn(roles) {
+		if (len(roles) == 0) { false } else { if (first(roles) == role) { true } else { has(tail(roles)) } }
+	};
+	user.Age >= minAge == has(user.roles)
+};
+let summary = fn(user) { { "name": user.Name, "tags": [user.Age, minAge] } };`
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		if err := interp.Set("minAge", 18); err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		if _, err := interp.Run(input); err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		ana := user{Name: "ana", Age: 30, Roles: []string{"dev", "admin"}}
+
+		res, err := interp.Call("allowed", ana, "admin")
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		var allowed bool
+		if err := object.ToGo(res, &allowed); err != nil || !allowed {
+			t.Errorf("expected ana to be allowed with the %s backend, got %v (%v)", backend, res.Inspect(), err)
+		}
+
+		res, err = interp.Call("summary", &ana)
+		if err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		var summary struct {
+			Name string `dsb:"name"`
+			Tags []int  `dsb:"tags"`
+		}
+		if err := object.ToGo(res, &summary); err != nil {
+			t.Fatalf("unexpected error converting with the %s backend: %v", backend, err)
+		}
+		if summary.Name != "ana" || len(summary.Tags) != 2 || summary.Tags[0] != 30 || summary.Tags[1] != 18 {
+			t.Errorf("wrong summary with the %s backend, got %+v", backend, summary)
+		}
+
+		if got, ok := interp.Get("minAge"); !ok || got.Inspect() != "18" {
+			t.Errorf("wrong minAge with the %s backend, got %v", backend, got)
+		}
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []any
+		expected string
+	}{
+		{"missing", nil, "identifier not found: missing"},
+		{"notFn", nil, "not a function: INTEGER"},
+		{"add", []any{1}, "wrong number of arguments: expected 2, got 1"},
+		{"add", []any{1, "a"}, "type mismatch: INTEGER + STRING"},
+		{"add", []any{1, make(chan int)}, "error calling add: argument 1: cannot convert value of type chan int"},
+	}
+
+	for _, backend := range []Backend{EvaluatorBackend, VMBackend} {
+		interp := NewWithBackend(backend)
+
+		if _, err := interp.Run("let notFn = 1; let add = fn(a, b) { a + b };"); err != nil {
+			t.Fatalf("unexpected error with the %s backend: %v", backend, err)
+		}
+
+		for _, tt := range tests {
+			_, err := interp.Call(tt.name, tt.args...)
+			if err == nil {
+				t.Errorf("expected an error calling %s with the %s backend", tt.name, backend)
+				continue
+			}
+
+			got := err.Error()
+
+			var evalErr *EvalError
+			if errors.As(err, &evalErr) {
+				got = evalErr.Message
+			}
+
+			if got != tt.expected {
+				t.Errorf("wrong error calling %s with the %s backend. want %q, got %q", tt.name, backend, tt.expected, got)
+			}
+		}
+	}
+}
@@ -7,10 +7,13 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	line   int
+	column int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 
 	l.readChar()
 
@@ -22,6 +25,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhiteSpace()
 
+	pos := token.Position{Line: l.line, Column: l.column}
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -73,6 +78,8 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '.':
+		tok = newToken(token.DOT, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -97,13 +104,14 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readForPredicate(isLetter)
+			tok.Literal = l.readForPredicate(isIdentifierChar)
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readForPredicate(isDigit)
-			tok.Type = token.INT
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos = pos
 
 			return tok
 		} else {
@@ -112,11 +120,18 @@ func (l *Lexer) NextToken() token.Token {
 
 	}
 
+	tok.Pos = pos
+
 	l.readChar()
 	return tok
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -125,6 +140,7 @@ func (l *Lexer) readChar() {
 
 	l.position = l.readPosition
 	l.readPosition += 1
+	l.column += 1
 }
 
 func (l *Lexer) peekChar() byte {
@@ -157,6 +173,22 @@ func (l *Lexer) readForPredicate(predicate func(byte) bool) string {
 	return l.input[position:l.position]
 }
 
+// readNumber reads an integer, or a float if its digits are followed by a
+// dot and more digits, like 1.5.
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	position := l.position
+	l.readForPredicate(isDigit)
+
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return token.INT, l.input[position:l.position]
+	}
+
+	l.readChar()
+	l.readForPredicate(isDigit)
+
+	return token.FLOAT, l.input[position:l.position]
+}
+
 func (l *Lexer) skipWhiteSpace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -172,6 +204,10 @@ func isLetter(char byte) bool {
 		char >= 'A' && char <= 'Z' || char == '_'
 }
 
+func isIdentifierChar(char byte) bool {
+	return isLetter(char) || isDigit(char)
+}
+
 func isDigit(char byte) bool {
 	return char >= '0' && char <= '9'
 }
@@ -45,6 +45,14 @@ null
 
 macro(x, y) { x + y; };
 
+point.move(1);
+
+1 in {1, 2};
+
+tmp__1 x2y;
+
+3.25 1.x 7.;
+
 !`
 
 	tests := []struct {
@@ -183,6 +191,35 @@ macro(x, y) { x + y; };
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
 
+		{token.IDENT, "point"},
+		{token.DOT, "."},
+		{token.IDENT, "move"},
+		{token.LPAREN, "("},
+		{token.INT, "1"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+
+		{token.INT, "1"},
+		{token.IN, "in"},
+		{token.LBRACE, "{"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+
+		{token.IDENT, "tmp__1"},
+		{token.IDENT, "x2y"},
+		{token.SEMICOLON, ";"},
+
+		{token.FLOAT, "3.25"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "7"},
+		{token.DOT, "."},
+		{token.SEMICOLON, ";"},
+
 		{token.BANG, "!"},
 		{token.EOF, ""},
 	}
@@ -201,3 +238,44 @@ macro(x, y) { x + y; };
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  add(x,
+	"a b");`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"add", 2, 3},
+		{"(", 2, 6},
+		{"x", 2, 7},
+		{",", 2, 8},
+		{"a b", 3, 2},
+		{")", 3, 7},
+		{";", 3, 8},
+		{"", 3, 9},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d]: wrong Literal. expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d]: wrong position for %q. expected %d:%d, got %s",
+				i, tt.expectedLiteral, tt.expectedLine, tt.expectedColumn, tok.Pos)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package limits bounds how much work a single run of a program can do, so
+// scripts from untrusted sources can't hang or take down the process that
+// embeds dsb. Both backends keep a Meter for each run and stop with the
+// Meter's error as soon as one of the limits is exceeded.
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/estevesnp/dsb/pkg/object"
+)
+
+// Limits are the bounds for a run. A zero field means no limit, except for
+// MaxDepth, where it means the backend's default.
+type Limits struct {
+	// MaxSteps is how many steps a run can take. A step is a node
+	// evaluated by the evaluator or an instruction executed by the VM.
+	MaxSteps int64
+
+	// MaxDepth is how many calls can be nested.
+	MaxDepth int
+
+	// MaxAlloc is roughly how many bytes of values a run can create. Every
+	// value counts, even ones that are garbage soon after, so it bounds
+	// the total a run allocates, not how much it holds at once.
+	MaxAlloc int64
+}
+
+var (
+	ErrSteps = errors.New("step limit exceeded")
+	ErrDepth = errors.New("stack overflow")
+	ErrAlloc = errors.New("allocation limit exceeded")
+)
+
+// DepthError returns the error for a call nested deeper than max.
+func DepthError(max int) error {
+	return fmt.Errorf("%w: more than %d nested calls", ErrDepth, max)
+}
+
+// ctxCheckInterval is how many steps go by between checks of the context,
+// which are too slow to make on every step.
+const ctxCheckInterval = 1 << 10
+
+// Meter tracks a run against its Limits and its context. Once a limit is
+// exceeded or the context is done, every later call returns the same error.
+type Meter struct {
+	ctx    context.Context
+	limits Limits
+
+	steps int64
+	alloc int64
+	err   error
+}
+
+func NewMeter(ctx context.Context, limits Limits) *Meter {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	m := &Meter{limits: limits}
+	m.ctx = object.WithAllocator(ctx, m.Alloc)
+
+	return m
+}
+
+// Context returns the context of the run, which carries the Meter's Alloc
+// for builtins to count large values with before they build them.
+func (m *Meter) Context() context.Context {
+	return m.ctx
+}
+
+// MaxDepth returns the depth limit, or def if there is none.
+func (m *Meter) MaxDepth(def int) int {
+	if m.limits.MaxDepth > 0 {
+		return m.limits.MaxDepth
+	}
+
+	return def
+}
+
+// Step counts a step.
+func (m *Meter) Step() error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.steps += 1
+
+	if max := m.limits.MaxSteps; max > 0 && m.steps > max {
+		m.err = fmt.Errorf("%w: more than %d steps", ErrSteps, max)
+		return m.err
+	}
+
+	if m.steps%ctxCheckInterval == 0 {
+		m.err = m.ctx.Err()
+	}
+
+	return m.err
+}
+
+// Alloc counts size bytes as allocated.
+func (m *Meter) Alloc(size int64) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.alloc += size
+
+	if max := m.limits.MaxAlloc; max > 0 && m.alloc > max {
+		m.err = fmt.Errorf("%w: more than %d bytes", ErrAlloc, max)
+	}
+
+	return m.err
+}
+
+// Err returns the error that stopped the run, or nil if nothing has.
+func (m *Meter) Err() error {
+	return m.err
+}
+
+// Approximate sizes, in bytes, of what values take in memory.
+const (
+	wordSize   = 8
+	headerSize = 2 * wordSize
+)
+
+// EnvironmentSize returns roughly how many bytes a call's environment, or
+// frame, with room for locals variables takes.
+func EnvironmentSize(locals int) int64 {
+	return 4*wordSize + wordSize*int64(locals)
+}
+
+// SizeOf returns roughly how many bytes creating obj allocated. Elements of
+// collections are counted as references, since they were created, and
+// counted, on their own.
+func SizeOf(obj object.Object) int64 {
+	switch obj := obj.(type) {
+	case nil, *object.Boolean, *object.Null:
+		return 0
+	case *object.Integer, *object.Float:
+		return headerSize
+	case *object.String:
+		return headerSize + int64(len(obj.Value))
+	case *object.Array:
+		return headerSize + wordSize*int64(len(obj.Elements))
+	case *object.Map:
+		return headerSize + 4*wordSize*int64(len(obj.Pairs))
+	case *object.Set:
+		return headerSize + 2*wordSize*int64(len(obj.Elements))
+	case *object.Closure:
+		return headerSize + wordSize*int64(len(obj.Free))
+	default:
+		return headerSize + 2*wordSize
+	}
+}
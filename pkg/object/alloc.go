@@ -0,0 +1,23 @@
+package object
+
+import "context"
+
+type allocatorKey struct{}
+
+// WithAllocator returns a copy of ctx carrying alloc, which builtins that
+// build large values call with their size before they do, so the run can
+// refuse to if it's over its allocation limit.
+func WithAllocator(ctx context.Context, alloc func(size int64) error) context.Context {
+	return context.WithValue(ctx, allocatorKey{}, alloc)
+}
+
+// Allocate counts size bytes with the allocator ctx carries, if it carries
+// one, returning its error.
+func Allocate(ctx context.Context, size int64) error {
+	alloc, ok := ctx.Value(allocatorKey{}).(func(size int64) error)
+	if !ok {
+		return nil
+	}
+
+	return alloc(size)
+}
@@ -0,0 +1,693 @@
+package object
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+)
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+// Builtins lists every builtin function and standard module. The compiler
+// refers to builtins by their index in this list, so new builtins must be
+// appended at the end.
+var Builtins = []struct {
+	Name  string
+	Value Object
+}{
+	{"print", &Builtin{Fn: builtinPrint}},
+	{"typeOf", &Builtin{Fn: builtinTypeOf}},
+	{"len", &Builtin{Fn: builtinLen}},
+	{"first", &Builtin{Fn: builtinFirst}},
+	{"last", &Builtin{Fn: builtinLast}},
+	{"tail", &Builtin{Fn: builtinTail}},
+	{"push", &Builtin{Fn: builtinPush}},
+	{"type", &Builtin{Fn: builtinDefineType}},
+	{"sort", &Builtin{Fn: builtinSort}},
+	{"set", &Builtin{Fn: builtinNewSet}},
+	{"union", &Builtin{Fn: builtinUnion}},
+	{"intersection", &Builtin{Fn: builtinIntersection}},
+	{"difference", &Builtin{Fn: builtinDifference}},
+	{"isSubset", &Builtin{Fn: builtinIsSubset}},
+	{"isSuperset", &Builtin{Fn: builtinIsSuperset}},
+	{"toArray", &Builtin{Fn: builtinToArray}},
+	{"keys", &Builtin{Fn: builtinKeys}},
+	{"values", &Builtin{Fn: builtinValues}},
+	{"entries", &Builtin{Fn: builtinEntries}},
+	{"gensym", &Builtin{Fn: builtinGensym}},
+	{"unhygienic", &Builtin{Fn: builtinUnhygienic}},
+	{"astKind", &Builtin{Fn: builtinAstKind}},
+	{"astChildren", &Builtin{Fn: builtinAstChildren}},
+	{"println", &Builtin{Fn: builtinPrintln}},
+	{"eprint", &Builtin{Fn: builtinEprint}},
+	{"printf", &Builtin{ContextFn: builtinPrintf}},
+	{"readLine", &Builtin{Fn: builtinReadLine}},
+	{"input", &Builtin{Fn: builtinInput}},
+	{"format", &Builtin{ContextFn: builtinFormat}},
+	{"strings", stringsModule},
+	{"int", &Builtin{Fn: builtinInt}},
+	{"float", &Builtin{Fn: builtinFloat}},
+	{"str", &Builtin{Fn: builtinStr}},
+	{"toString", &Builtin{Fn: builtinStr}},
+	{"bool", &Builtin{Fn: builtinBool}},
+	{"parseInt", &Builtin{Fn: builtinParseInt}},
+	{"json", jsonModule},
+	{"eprintln", &Builtin{Fn: builtinEprintln}},
+	{"macroexpand", &Builtin{Fn: builtinNoMacros}},
+	{"macroexpand1", &Builtin{Fn: builtinNoMacros}},
+}
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			builtin, _ := def.Value.(*Builtin)
+			return builtin
+		}
+	}
+
+	return nil
+}
+
+func NativeBoolToBooleanObject(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+
+	return FALSE
+}
+
+// NewInstance creates a value of userType, copying the fields of the map
+// passed as its only argument, if any.
+func NewInstance(userType *UserType, args []Object) Object {
+	instance := NewMap()
+	instance.UserType = userType
+
+	if len(args) == 0 {
+		return instance
+	}
+
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	fields, ok := args[0].(*Map)
+	if !ok {
+		return notSupported(userType.Name, args[0])
+	}
+
+	for _, pair := range fields.Items() {
+		instance.Set(pair.Key.(Hashable), pair.Value)
+	}
+
+	return instance
+}
+
+func builtinPrint(args ...Object) Object {
+	return printTo(os.Stdout, args, "")
+}
+
+func builtinPrintln(args ...Object) Object {
+	return printTo(os.Stdout, args, "\n")
+}
+
+func builtinEprint(args ...Object) Object {
+	return printTo(os.Stderr, args, "")
+}
+
+func builtinEprintln(args ...Object) Object {
+	return printTo(os.Stderr, args, "\n")
+}
+
+// builtinNoMacros stands for macroexpand and macroexpand1 outside of a
+// Runtime, which has no macros to expand with.
+func builtinNoMacros(args ...Object) Object {
+	return newError("no macros to expand with")
+}
+
+func builtinPrintf(ctx context.Context, args ...Object) Object {
+	return printfTo(ctx, os.Stdout, args)
+}
+
+// The builtins in Builtins read os.Stdin a byte at a time, since buffering
+// it would lose what's read ahead once they return.
+func builtinReadLine(args ...Object) Object {
+	return readLineFrom(byteReader{os.Stdin}, args)
+}
+
+func builtinInput(args ...Object) Object {
+	return inputFrom(os.Stdout, byteReader{os.Stdin}, args)
+}
+
+// printTo writes args to w separated by spaces, followed by end.
+func printTo(w io.Writer, args []Object, end string) Object {
+	arguments := make([]string, len(args))
+
+	for idx, arg := range args {
+		arguments[idx] = arg.Inspect()
+	}
+
+	io.WriteString(w, strings.Join(arguments, " ")+end)
+
+	return NULL
+}
+
+func printfTo(ctx context.Context, w io.Writer, args []Object) Object {
+	out, err := formatArguments(ctx, "printf", args)
+	if err != nil {
+		return err
+	}
+
+	io.WriteString(w, out)
+
+	return NULL
+}
+
+func builtinFormat(ctx context.Context, args ...Object) Object {
+	out, err := formatArguments(ctx, "format", args)
+	if err != nil {
+		return err
+	}
+
+	return &String{Value: out}
+}
+
+// formatArguments formats the arguments of printf or format, a format
+// followed by the values it formats.
+func formatArguments(ctx context.Context, name string, args []Object) (string, *Error) {
+	if n := len(args); n < 1 {
+		return "", newError("wrong number of arguments: expected at least 1, got %d", n)
+	}
+
+	format, ok := args[0].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+	}
+
+	return Format(ctx, format.Value, args[1:])
+}
+
+// readLineFrom returns the next line read from r, without its line ending,
+// or null once there's nothing left to read.
+func readLineFrom(r io.ByteReader, args []Object) Object {
+	if err := validateLength(0, args); err != nil {
+		return err
+	}
+
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			if len(line) == 0 {
+				return NULL
+			}
+			break
+		}
+		if err != nil {
+			return &Error{Message: fmt.Sprintf("error reading line: %s", err), Err: err}
+		}
+
+		if b == '\n' {
+			break
+		}
+		line = append(line, b)
+	}
+
+	line, _ = bytes.CutSuffix(line, []byte("\r"))
+
+	return &String{Value: string(line)}
+}
+
+// inputFrom writes the prompt passed to input, if any, to w, and then reads
+// a line from r.
+func inputFrom(w io.Writer, r io.ByteReader, args []Object) Object {
+	if n := len(args); n > 1 {
+		return newError("wrong number of arguments: expected at most 1, got %d", n)
+	}
+
+	if len(args) == 1 {
+		io.WriteString(w, args[0].Inspect())
+	}
+
+	return readLineFrom(r, nil)
+}
+
+// byteReader reads r a byte at a time, without reading ahead.
+type byteReader struct {
+	r io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	for {
+		n, err := br.r.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func builtinTypeOf(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	if m, ok := args[0].(*Map); ok && m.UserType != nil {
+		return &String{Value: m.UserType.Name}
+	}
+
+	return &String{Value: string(args[0].Type())}
+}
+
+func builtinLen(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *String:
+		length := len([]rune(arg.Value))
+		return &Integer{Value: int64(length)}
+	case *Array:
+		length := len(arg.Elements)
+		return &Integer{Value: int64(length)}
+	case *Set:
+		length := len(arg.Elements)
+		return &Integer{Value: int64(length)}
+	default:
+		return notSupported("len", args[0])
+	}
+}
+
+func builtinFirst(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("first", args[0])
+	}
+
+	if len(arr.Elements) == 0 {
+		return NULL
+	}
+
+	return arr.Elements[0]
+}
+
+func builtinLast(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("last", args[0])
+	}
+
+	length := len(arr.Elements)
+
+	if length == 0 {
+		return NULL
+	}
+
+	return arr.Elements[length-1]
+}
+
+func builtinTail(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("tail", args[0])
+	}
+
+	length := len(arr.Elements)
+
+	if length == 0 {
+		return NULL
+	}
+
+	newElems := make([]Object, length-1)
+	copy(newElems, arr.Elements[1:length])
+
+	return &Array{Elements: newElems}
+}
+
+func builtinPush(args ...Object) Object {
+	if n := len(args); n < 2 {
+		return newError("wrong number of arguments: expected at least 2, got %d", n)
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("push", args[0])
+	}
+
+	length := len(arr.Elements)
+
+	newElems := make([]Object, length, length+len(args)-1)
+	copy(newElems, arr.Elements)
+
+	newElems = append(newElems, args[1:]...)
+
+	return &Array{Elements: newElems}
+}
+
+func builtinSort(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("sort", args[0])
+	}
+
+	newElems := slices.Clone(arr.Elements)
+	slices.SortStableFunc(newElems, Compare)
+
+	return &Array{Elements: newElems}
+}
+
+func builtinDefineType(args ...Object) Object {
+	if err := validateLength(2, args); err != nil {
+		return err
+	}
+
+	name, ok := args[0].(*String)
+	if !ok {
+		return notSupported("type", args[0])
+	}
+
+	methods, ok := args[1].(*Map)
+	if !ok {
+		return notSupported("type", args[1])
+	}
+
+	table := make(map[string]Object, len(methods.Pairs))
+
+	for _, pair := range methods.Items() {
+		methodName, ok := pair.Key.(*String)
+		if !ok {
+			return newError("method name must be STRING, got %s", pair.Key.Type())
+		}
+
+		switch pair.Value.(type) {
+		case *Function, *Closure, *Builtin:
+			table[methodName.Value] = pair.Value
+		default:
+			return newError("method %q is not a function, got %s", methodName.Value, pair.Value.Type())
+		}
+	}
+
+	return &UserType{Name: name.Value, Methods: table}
+}
+
+func builtinKeys(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	m, ok := args[0].(*Map)
+	if !ok {
+		return notSupported("keys", args[0])
+	}
+
+	items := m.Items()
+	keys := make([]Object, len(items))
+	for idx, pair := range items {
+		keys[idx] = pair.Key
+	}
+
+	return &Array{Elements: keys}
+}
+
+func builtinValues(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	m, ok := args[0].(*Map)
+	if !ok {
+		return notSupported("values", args[0])
+	}
+
+	items := m.Items()
+	values := make([]Object, len(items))
+	for idx, pair := range items {
+		values[idx] = pair.Value
+	}
+
+	return &Array{Elements: values}
+}
+
+func builtinEntries(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	m, ok := args[0].(*Map)
+	if !ok {
+		return notSupported("entries", args[0])
+	}
+
+	items := m.Items()
+	entries := make([]Object, len(items))
+	for idx, pair := range items {
+		entries[idx] = &Array{Elements: []Object{pair.Key, pair.Value}}
+	}
+
+	return &Array{Elements: entries}
+}
+
+func builtinNewSet(args ...Object) Object {
+	set := NewSet()
+
+	if len(args) == 0 {
+		return set
+	}
+
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return notSupported("set", args[0])
+	}
+
+	for _, el := range arr.Elements {
+		if !IsHashable(el) {
+			return newError("unusable as set element: %s", el.Type())
+		}
+		set.Add(el.(Hashable))
+	}
+
+	return set
+}
+
+func builtinUnion(args ...Object) Object {
+	left, right, err := setArguments("union", args)
+	if err != nil {
+		return err
+	}
+
+	set := NewSet()
+	for _, el := range left.Items() {
+		set.Add(el.(Hashable))
+	}
+	for _, el := range right.Items() {
+		set.Add(el.(Hashable))
+	}
+
+	return set
+}
+
+func builtinIntersection(args ...Object) Object {
+	left, right, err := setArguments("intersection", args)
+	if err != nil {
+		return err
+	}
+
+	set := NewSet()
+	for _, el := range left.Items() {
+		if right.Has(el.(Hashable)) {
+			set.Add(el.(Hashable))
+		}
+	}
+
+	return set
+}
+
+func builtinDifference(args ...Object) Object {
+	left, right, err := setArguments("difference", args)
+	if err != nil {
+		return err
+	}
+
+	set := NewSet()
+	for _, el := range left.Items() {
+		if !right.Has(el.(Hashable)) {
+			set.Add(el.(Hashable))
+		}
+	}
+
+	return set
+}
+
+func builtinIsSubset(args ...Object) Object {
+	left, right, err := setArguments("isSubset", args)
+	if err != nil {
+		return err
+	}
+
+	return NativeBoolToBooleanObject(isSubset(left, right))
+}
+
+func builtinIsSuperset(args ...Object) Object {
+	left, right, err := setArguments("isSuperset", args)
+	if err != nil {
+		return err
+	}
+
+	return NativeBoolToBooleanObject(isSubset(right, left))
+}
+
+func builtinToArray(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	set, ok := args[0].(*Set)
+	if !ok {
+		return notSupported("toArray", args[0])
+	}
+
+	return &Array{Elements: set.Items()}
+}
+
+// Gensym returns a quoted identifier with a fresh name, optionally built
+// from a prefix, for macros that need names nobody else can refer to.
+func builtinGensym(args ...Object) Object {
+	prefix := "g"
+
+	switch len(args) {
+	case 0:
+	case 1:
+		str, ok := args[0].(*String)
+		if !ok {
+			return notSupported("gensym", args[0])
+		}
+		prefix = str.Value
+	default:
+		return newError("wrong number of arguments: expected at most 1, got %d", len(args))
+	}
+
+	return &Quote{Node: NewIdentifier(FreshName(prefix))}
+}
+
+// Unhygienic marks a quote so that expanding it keeps the names it binds,
+// letting a macro deliberately introduce bindings into the caller's scope.
+func builtinUnhygienic(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	quote, ok := args[0].(*Quote)
+	if !ok {
+		return notSupported("unhygienic", args[0])
+	}
+
+	return &Quote{Node: quote.Node, Unhygienic: true}
+}
+
+func builtinAstKind(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	quote, ok := args[0].(*Quote)
+	if !ok {
+		return notSupported("astKind", args[0])
+	}
+
+	return &String{Value: ASTKind(quote.Node)}
+}
+
+func builtinAstChildren(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	quote, ok := args[0].(*Quote)
+	if !ok {
+		return notSupported("astChildren", args[0])
+	}
+
+	children := ast.Children(quote.Node)
+	elements := make([]Object, len(children))
+	for i, child := range children {
+		elements[i] = &Quote{Node: child}
+	}
+
+	return &Array{Elements: elements}
+}
+
+func isSubset(left, right *Set) bool {
+	for _, el := range left.Elements {
+		if !right.Has(el.(Hashable)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func setArguments(name string, args []Object) (*Set, *Set, *Error) {
+	if err := validateLength(2, args); err != nil {
+		return nil, nil, err
+	}
+
+	left, ok := args[0].(*Set)
+	if !ok {
+		return nil, nil, notSupported(name, args[0])
+	}
+
+	right, ok := args[1].(*Set)
+	if !ok {
+		return nil, nil, notSupported(name, args[1])
+	}
+
+	return left, right, nil
+}
+
+func notSupported(name string, obj Object) *Error {
+	return newError("argument to `%s` not supported, got %s", name, obj.Type())
+}
+
+func validateLength(length int, args []Object) *Error {
+	if n := len(args); n != length {
+		return newError("wrong number of arguments: expected %d, got %d", length, n)
+	}
+	return nil
+}
+
+func newError(format string, args ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...)}
+}
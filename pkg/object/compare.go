@@ -0,0 +1,302 @@
+package object
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+var typeOrder = map[ObjectType]int{
+	NULL_OBJ:    0,
+	BOOLEAN_OBJ: 1,
+	INTEGER_OBJ: 2,
+	FLOAT_OBJ:   2,
+	STRING_OBJ:  3,
+	ARRAY_OBJ:   4,
+	MAP_OBJ:     5,
+	SET_OBJ:     6,
+}
+
+type objectPair struct {
+	left  Object
+	right Object
+}
+
+// Equal compares arrays and maps by content and non-primitives by identity.
+func Equal(a, b Object) bool {
+	return equal(a, b, map[objectPair]bool{})
+}
+
+func equal(a, b Object, visiting map[objectPair]bool) bool {
+	if a == b {
+		return true
+	}
+
+	if a.Type() != b.Type() {
+		return NumbersEqual(a, b)
+	}
+
+	switch a := a.(type) {
+
+	case *Null:
+		return true
+
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+
+	case *Float:
+		return NumbersEqual(a, b)
+
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+
+	case *String:
+		return a.Value == b.(*String).Value
+
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		pair := objectPair{a, b}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for idx, el := range a.Elements {
+			if !equal(el, b.Elements[idx], visiting) {
+				return false
+			}
+		}
+
+		return true
+
+	case *Map:
+		b := b.(*Map)
+		if a.UserType != b.UserType || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+
+		pair := objectPair{a, b}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for _, aPair := range a.Pairs {
+			bPair, ok := b.Get(aPair.Key.(Hashable))
+			if !ok || !equal(aPair.Value, bPair.Value, visiting) {
+				return false
+			}
+		}
+
+		return true
+
+	case *Set:
+		b := b.(*Set)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+
+		for _, el := range a.Elements {
+			if !b.Has(el.(Hashable)) {
+				return false
+			}
+		}
+
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Compare orders objects by type first (null, boolean, number, string,
+// array, map, set, rest), then by value. Integers and floats are compared
+// as numbers, with an integer first when they're equal.
+func Compare(a, b Object) int {
+	return compare(a, b, map[objectPair]bool{})
+}
+
+func compare(a, b Object, visiting map[objectPair]bool) int {
+	if a == b {
+		return 0
+	}
+
+	if c := compareTypes(a.Type(), b.Type()); c != 0 {
+		return c
+	}
+
+	if a.Type() != b.Type() {
+		if c := compareNumbers(a, b); c != 0 {
+			return c
+		}
+		if a.Type() == INTEGER_OBJ {
+			return -1
+		}
+		return 1
+	}
+
+	switch a := a.(type) {
+
+	case *Null:
+		return 0
+
+	case *Integer:
+		return cmp.Compare(a.Value, b.(*Integer).Value)
+
+	case *Float:
+		return cmp.Compare(a.Value, b.(*Float).Value)
+
+	case *Boolean:
+		return compareBools(a.Value, b.(*Boolean).Value)
+
+	case *String:
+		return cmp.Compare(a.Value, b.(*String).Value)
+
+	case *Array:
+		b := b.(*Array)
+
+		pair := objectPair{a, b}
+		if visiting[pair] {
+			return 0
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		for idx := 0; idx < len(a.Elements) && idx < len(b.Elements); idx++ {
+			if c := compare(a.Elements[idx], b.Elements[idx], visiting); c != 0 {
+				return c
+			}
+		}
+
+		return cmp.Compare(len(a.Elements), len(b.Elements))
+
+	case *Map:
+		b := b.(*Map)
+
+		pair := objectPair{a, b}
+		if visiting[pair] {
+			return 0
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+
+		aPairs := sortedPairs(a, visiting)
+		bPairs := sortedPairs(b, visiting)
+
+		for idx := 0; idx < len(aPairs) && idx < len(bPairs); idx++ {
+			if c := compare(aPairs[idx].Key, bPairs[idx].Key, visiting); c != 0 {
+				return c
+			}
+
+			if c := compare(aPairs[idx].Value, bPairs[idx].Value, visiting); c != 0 {
+				return c
+			}
+		}
+
+		return cmp.Compare(len(aPairs), len(bPairs))
+
+	case *Set:
+		aItems := a.Items()
+		bItems := b.(*Set).Items()
+
+		slices.SortFunc(aItems, Compare)
+		slices.SortFunc(bItems, Compare)
+
+		return compare(&Array{Elements: aItems}, &Array{Elements: bItems}, visiting)
+
+	default:
+		return cmp.Compare(a.Inspect(), b.Inspect())
+	}
+}
+
+func compareTypes(a, b ObjectType) int {
+	aOrder, aKnown := typeOrder[a]
+	bOrder, bKnown := typeOrder[b]
+
+	switch {
+	case aKnown && bKnown:
+		return cmp.Compare(aOrder, bOrder)
+	case aKnown:
+		return -1
+	case bKnown:
+		return 1
+	default:
+		return cmp.Compare(a, b)
+	}
+}
+
+// NumbersEqual reports whether a and b are numbers with the same value. An
+// integer only equals a float that's a whole number converting to it
+// exactly, so 1 == 1.0 but 2^53 + 1 isn't the float it would round to.
+func NumbersEqual(a, b Object) bool {
+	switch a := a.(type) {
+
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return a.Value == b.Value
+		case *Float:
+			value, ok := floatToInteger(b.Value)
+			return ok && value == a.Value
+		}
+
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			value, ok := floatToInteger(a.Value)
+			return ok && value == b.Value
+		case *Float:
+			return a.Value == b.Value
+		}
+	}
+
+	return false
+}
+
+// floatToInteger returns f as an int64, or false if it isn't a whole number
+// an int64 can hold.
+func floatToInteger(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(f), true
+}
+
+// compareNumbers compares an integer and a float, or the other way around.
+func compareNumbers(a, b Object) int {
+	aVal, _ := ToFloat(a)
+	bVal, _ := ToFloat(b)
+
+	return cmp.Compare(aVal, bVal)
+}
+
+func compareBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func sortedPairs(m *Map, visiting map[objectPair]bool) []HashPair {
+	pairs := make([]HashPair, 0, len(m.Pairs))
+	for _, pair := range m.Pairs {
+		pairs = append(pairs, pair)
+	}
+
+	slices.SortFunc(pairs, func(a, b HashPair) int {
+		return compare(a.Key, b.Key, visiting)
+	})
+
+	return pairs
+}
@@ -0,0 +1,151 @@
+package object
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// ToFloat returns the value of an Integer or a Float as a float64, or false
+// if obj isn't a number.
+func ToFloat(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// builtinInt converts a number, a string of decimal digits or a boolean to
+// an integer, dropping the fraction of a float.
+func builtinInt(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+
+	case *Integer:
+		return arg
+
+	case *Float:
+		if math.IsNaN(arg.Value) || arg.Value < math.MinInt64 || arg.Value >= math.MaxInt64 {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		return &Integer{Value: int64(arg.Value)}
+
+	case *String:
+		return parseInteger(arg.Value, 10)
+
+	case *Boolean:
+		if arg.Value {
+			return &Integer{Value: 1}
+		}
+		return &Integer{Value: 0}
+
+	default:
+		return newError("argument to `int` not supported, got %s", arg.Type())
+	}
+}
+
+// builtinFloat converts a number, a string holding one or a boolean to a
+// float.
+func builtinFloat(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+
+	case *Integer:
+		return &Float{Value: float64(arg.Value)}
+
+	case *Float:
+		return arg
+
+	case *String:
+		value, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return newError("cannot parse %q as FLOAT", arg.Value)
+		}
+		return &Float{Value: value}
+
+	case *Boolean:
+		if arg.Value {
+			return &Float{Value: 1}
+		}
+		return &Float{Value: 0}
+
+	default:
+		return newError("argument to `float` not supported, got %s", arg.Type())
+	}
+}
+
+// builtinStr returns what print would print for its argument.
+func builtinStr(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	if str, ok := args[0].(*String); ok {
+		return str
+	}
+
+	return &String{Value: args[0].Inspect()}
+}
+
+// builtinBool returns whether its argument is truthy, which everything but
+// false and null is.
+func builtinBool(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	return NativeBoolToBooleanObject(args[0] != NULL && args[0] != FALSE)
+}
+
+// builtinParseInt parses a string as an integer in base, 10 if it's not
+// given. A base of 0 takes it from the string's prefix, like 0x for 16.
+func builtinParseInt(args ...Object) Object {
+	if n := len(args); n < 1 || n > 2 {
+		return newError("wrong number of arguments: expected 1 or 2, got %d", n)
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `parseInt` not supported, got %s", args[0].Type())
+	}
+
+	base := int64(10)
+	if len(args) == 2 {
+		integer, ok := args[1].(*Integer)
+		if !ok {
+			return newError("base to `parseInt` must be INTEGER, got %s", args[1].Type())
+		}
+
+		base = integer.Value
+		if base != 0 && (base < 2 || base > 36) {
+			return newError("base to `parseInt` must be 0 or between 2 and 36, got %d", base)
+		}
+	}
+
+	return parseInteger(str.Value, int(base))
+}
+
+func parseInteger(s string, base int) Object {
+	value, err := strconv.ParseInt(s, base, 64)
+
+	switch {
+	case errors.Is(err, strconv.ErrRange):
+		return newError("%q is out of range for INTEGER", s)
+	case err != nil && base == 10:
+		return newError("cannot parse %q as INTEGER", s)
+	case err != nil:
+		return newError("cannot parse %q as INTEGER in base %d", s, base)
+	default:
+		return &Integer{Value: value}
+	}
+}
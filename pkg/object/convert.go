@@ -0,0 +1,419 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+)
+
+var objectType = reflect.TypeFor[Object]()
+
+// FromGo converts a Go value to an Object. Integers of every size become
+// Integers, floats become Floats, slices and arrays become Arrays and maps become Maps, with their
+// keys sorted, since Go maps have no order. Structs become Maps from their
+// exported field names, or the name in a `dsb:"name"` tag, to their values,
+// with fields tagged `dsb:"-"` left out. Nil pointers and interfaces become
+// null, and Objects are returned as they are.
+func FromGo(v any) (Object, error) {
+	return fromGo(reflect.ValueOf(v), map[uintptr]bool{})
+}
+
+// fromGo converts v, with seen holding the pointers being converted, to
+// report cycles instead of following them forever.
+func fromGo(v reflect.Value, seen map[uintptr]bool) (Object, error) {
+	if !v.IsValid() {
+		return NULL, nil
+	}
+
+	if v.Type().Implements(objectType) && v.CanInterface() {
+		if v.Kind() == reflect.Pointer && v.IsNil() {
+			return NULL, nil
+		}
+		return v.Interface().(Object), nil
+	}
+
+	switch v.Kind() {
+
+	case reflect.Bool:
+		return NativeBoolToBooleanObject(v.Bool()), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", v.Uint())
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: v.Float()}, nil
+
+	case reflect.String:
+		return &String{Value: v.String()}, nil
+
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NULL, nil
+		}
+
+		if v.Kind() == reflect.Pointer {
+			if seen[v.Pointer()] {
+				return nil, fmt.Errorf("cannot convert cyclic value of type %s", v.Type())
+			}
+			seen[v.Pointer()] = true
+			defer delete(seen, v.Pointer())
+		}
+
+		return fromGo(v.Elem(), seen)
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			if seen[v.Pointer()] {
+				return nil, fmt.Errorf("cannot convert cyclic value of type %s", v.Type())
+			}
+			seen[v.Pointer()] = true
+			defer delete(seen, v.Pointer())
+		}
+
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			el, err := fromGo(v.Index(i), seen)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+
+		return &Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if !v.IsNil() {
+			if seen[v.Pointer()] {
+				return nil, fmt.Errorf("cannot convert cyclic value of type %s", v.Type())
+			}
+			seen[v.Pointer()] = true
+			defer delete(seen, v.Pointer())
+		}
+
+		return mapFromGo(v, seen)
+
+	case reflect.Struct:
+		return structFromGo(v, seen)
+
+	default:
+		return nil, fmt.Errorf("cannot convert value of type %s", v.Type())
+	}
+}
+
+func mapFromGo(v reflect.Value, seen map[uintptr]bool) (Object, error) {
+	pairs := make([]HashPair, 0, v.Len())
+
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := fromGo(iter.Key(), seen)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+		}
+
+		if !IsHashable(key) {
+			return nil, fmt.Errorf("key %v: unusable as hash key: %s", iter.Key(), key.Type())
+		}
+
+		value, err := fromGo(iter.Value(), seen)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+		}
+
+		pairs = append(pairs, HashPair{Key: key, Value: value})
+	}
+
+	slices.SortFunc(pairs, func(a, b HashPair) int {
+		return Compare(a.Key, b.Key)
+	})
+
+	m := NewMap()
+	for _, pair := range pairs {
+		m.Set(pair.Key.(Hashable), pair.Value)
+	}
+
+	return m, nil
+}
+
+func structFromGo(v reflect.Value, seen map[uintptr]bool) (Object, error) {
+	m := NewMap()
+
+	for _, field := range reflect.VisibleFields(v.Type()) {
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+
+		value, err := fromGo(v.FieldByIndex(field.Index), seen)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		m.Set(&String{Value: name}, value)
+	}
+
+	return m, nil
+}
+
+// fieldName returns the name field has in a Map, or false if it's left out.
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() || field.Anonymous {
+		return "", false
+	}
+
+	switch tag := field.Tag.Get("dsb"); tag {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// ToGo stores obj in the value target points to, converting it to target's
+// type the way FromGo converts the other way, with integers converted to
+// float types too. Null sets the zero value, and a target of type any gets
+// int64, float64, string, bool, nil, []any and map[string]any values, or
+// obj itself if it's something like a function.
+func ToGo(obj Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+
+	return toGo(obj, v.Elem())
+}
+
+func toGo(obj Object, dst reflect.Value) error {
+	if obj == nil {
+		obj = NULL
+	}
+
+	if objType := reflect.TypeOf(obj); objType.AssignableTo(dst.Type()) && dst.Type() != reflect.TypeFor[any]() {
+		dst.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if obj == NULL {
+		dst.SetZero()
+		return nil
+	}
+
+	switch dst.Kind() {
+
+	case reflect.Interface:
+		value, err := goValue(obj)
+		if err != nil {
+			return err
+		}
+
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(dst.Type()) {
+			return cannotConvert(obj, dst.Type())
+		}
+		dst.Set(rv)
+
+	case reflect.Pointer:
+		elem := reflect.New(dst.Type().Elem())
+		if err := toGo(obj, elem.Elem()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+
+	case reflect.Bool:
+		boolean, ok := obj.(*Boolean)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		dst.SetBool(boolean.Value)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		if dst.OverflowInt(integer.Value) {
+			return fmt.Errorf("%d overflows %s", integer.Value, dst.Type())
+		}
+		dst.SetInt(integer.Value)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		if integer.Value < 0 || dst.OverflowUint(uint64(integer.Value)) {
+			return fmt.Errorf("%d overflows %s", integer.Value, dst.Type())
+		}
+		dst.SetUint(uint64(integer.Value))
+
+	case reflect.Float32, reflect.Float64:
+		value, ok := ToFloat(obj)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		dst.SetFloat(value)
+
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		dst.SetString(str.Value)
+
+	case reflect.Slice:
+		elements, ok := elementsOf(obj)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+
+		slice := reflect.MakeSlice(dst.Type(), len(elements), len(elements))
+		for i, el := range elements {
+			if err := toGo(el, slice.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		dst.Set(slice)
+
+	case reflect.Array:
+		elements, ok := elementsOf(obj)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+		if len(elements) != dst.Len() {
+			return fmt.Errorf("cannot convert %s of length %d to %s", obj.Type(), len(elements), dst.Type())
+		}
+
+		for i, el := range elements {
+			if err := toGo(el, dst.Index(i)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+
+	case reflect.Map:
+		m, ok := obj.(*Map)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+
+		out := reflect.MakeMapWithSize(dst.Type(), len(m.Pairs))
+		for _, pair := range m.Items() {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := toGo(pair.Key, key); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+
+			value := reflect.New(dst.Type().Elem()).Elem()
+			if err := toGo(pair.Value, value); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+
+			out.SetMapIndex(key, value)
+		}
+		dst.Set(out)
+
+	case reflect.Struct:
+		m, ok := obj.(*Map)
+		if !ok {
+			return cannotConvert(obj, dst.Type())
+		}
+
+		for _, field := range reflect.VisibleFields(dst.Type()) {
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+
+			pair, ok := m.Get(&String{Value: name})
+			if !ok {
+				continue
+			}
+
+			if err := toGo(pair.Value, dst.FieldByIndex(field.Index)); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+
+	default:
+		return cannotConvert(obj, dst.Type())
+	}
+
+	return nil
+}
+
+// goValue returns the Go value obj stands for when the target is any.
+func goValue(obj Object) (any, error) {
+	switch obj := obj.(type) {
+
+	case *Null:
+		return nil, nil
+
+	case *Boolean:
+		return obj.Value, nil
+
+	case *Integer:
+		return obj.Value, nil
+
+	case *Float:
+		return obj.Value, nil
+
+	case *String:
+		return obj.Value, nil
+
+	case *Array, *Set:
+		elements, _ := elementsOf(obj)
+
+		values := make([]any, len(elements))
+		for i, el := range elements {
+			value, err := goValue(el)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			values[i] = value
+		}
+
+		return values, nil
+
+	case *Map:
+		values := make(map[string]any, len(obj.Pairs))
+		for _, pair := range obj.Items() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return nil, fmt.Errorf("key %s: cannot convert %s to string", pair.Key.Inspect(), pair.Key.Type())
+			}
+
+			value, err := goValue(pair.Value)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key.Value, err)
+			}
+			values[key.Value] = value
+		}
+
+		return values, nil
+
+	default:
+		return obj, nil
+	}
+}
+
+func elementsOf(obj Object) ([]Object, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.Elements, true
+	case *Set:
+		return obj.Items(), true
+	default:
+		return nil, false
+	}
+}
+
+func cannotConvert(obj Object, to reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), to)
+}
@@ -0,0 +1,169 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	X, Y  int
+	Label string `dsb:"label"`
+	Skip  bool   `dsb:"-"`
+	note  string
+}
+
+func TestFromGo(t *testing.T) {
+	var nilPointer *point
+
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{int8(-3), "-3"},
+		{uint32(7), "7"},
+		{float32(0.5), "0.5"},
+		{2.0, "2.0"},
+		{"hi", "hi"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{point{X: 1, Y: 2, Label: "p", Skip: true, note: "n"}, "{X: 1, Y: 2, label: p}"},
+		{&point{X: 1}, "{X: 1, Y: 0, label: }"},
+		{nilPointer, "null"},
+		{[]any{1, "a", nil}, "[1, a, null]"},
+		{&Integer{Value: 5}, "5"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("unexpected error for %#v: %v", tt.input, err)
+			continue
+		}
+
+		if got := obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong conversion of %#v. want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	type node struct{ Next *node }
+	cyclic := &node{}
+	cyclic.Next = cyclic
+
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{uint64(1 << 63), "9223372036854775808 overflows INTEGER"},
+		{func() {}, "cannot convert value of type func()"},
+		{map[string]any{"f": make(chan int)}, "key f: cannot convert value of type chan int"},
+		{cyclic, "field Next: cannot convert cyclic value of type *object.node"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil {
+			t.Errorf("expected an error for %T", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %T. want %q, got %q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	m := NewMap()
+	m.Set(&String{Value: "X"}, &Integer{Value: 1})
+	m.Set(&String{Value: "label"}, &String{Value: "p"})
+	m.Set(&String{Value: "extra"}, TRUE)
+
+	var p point
+	if err := ToGo(m, &p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (point{X: 1, Label: "p"}); p != want {
+		t.Errorf("wrong struct. want %+v, got %+v", want, p)
+	}
+
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, NULL, &Integer{Value: 3}}}
+
+	var ints []int
+	if err := ToGo(arr, &ints); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []int{1, 0, 3}; !reflect.DeepEqual(ints, want) {
+		t.Errorf("wrong slice. want %v, got %v", want, ints)
+	}
+
+	var pointers []*int
+	if err := ToGo(arr, &pointers); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pointers[1] != nil || *pointers[2] != 3 {
+		t.Errorf("wrong pointers, got %v", pointers)
+	}
+
+	var generic any
+	if err := ToGo(&Array{Elements: []Object{m, &String{Value: "s"}}}, &generic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []any{map[string]any{"X": int64(1), "label": "p", "extra": true}, "s"}
+	if !reflect.DeepEqual(generic, want) {
+		t.Errorf("wrong value. want %#v, got %#v", want, generic)
+	}
+
+	var floats []float64
+	if err := ToGo(&Array{Elements: []Object{&Float{Value: 1.5}, &Integer{Value: 2}}}, &floats); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []float64{1.5, 2}; !reflect.DeepEqual(floats, want) {
+		t.Errorf("wrong floats. want %v, got %v", want, floats)
+	}
+
+	var obj Object
+	if err := ToGo(m, &obj); err != nil || obj != m {
+		t.Errorf("expected the map itself, got %v (%v)", obj, err)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	var small int8
+	var unsigned uint
+	var str string
+	var ints []int
+	var byName map[string]int
+
+	badKey := NewMap()
+	badKey.Set(&Integer{Value: 1}, &Integer{Value: 1})
+
+	tests := []struct {
+		obj      Object
+		target   any
+		expected string
+	}{
+		{&Integer{Value: 300}, &small, "300 overflows int8"},
+		{&Integer{Value: -1}, &unsigned, "-1 overflows uint"},
+		{&Integer{Value: 1}, &str, "cannot convert INTEGER to string"},
+		{&Array{Elements: []Object{&String{Value: "a"}}}, &ints, "element 0: cannot convert STRING to int"},
+		{badKey, &byName, "key 1: cannot convert INTEGER to string"},
+		{&Integer{Value: 1}, str, "target must be a non-nil pointer, got string"},
+	}
+
+	for _, tt := range tests {
+		err := ToGo(tt.obj, tt.target)
+		if err == nil {
+			t.Errorf("expected an error converting %s to %T", tt.obj.Inspect(), tt.target)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want %q, got %q", tt.expected, err.Error())
+		}
+	}
+}
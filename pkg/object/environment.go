@@ -1,8 +1,15 @@
 package object
 
+// Environment holds variables either by name, for globals and code that
+// hasn't been resolved, or in slots assigned by the resolver, for the locals
+// of a resolved function. A slot environment still answers lookups by name,
+// so unresolved code, like unquoted arguments, can run inside it.
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	slots []Object
+	names []string
 }
 
 func NewEnvironment() *Environment {
@@ -17,7 +24,23 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// NewSlotEnvironment returns an environment with one empty slot per name,
+// where names[i] is the variable held in slot i.
+func NewSlotEnvironment(outer *Environment, names []string) *Environment {
+	return &Environment{
+		outer: outer,
+		slots: make([]Object, len(names)),
+		names: names,
+	}
+}
+
 func (e *Environment) Get(name string) (Object, bool) {
+	for i := len(e.names) - 1; i >= 0; i -= 1 {
+		if e.names[i] == name && e.slots[i] != nil {
+			return e.slots[i], true
+		}
+	}
+
 	obj, ok := e.store[name]
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
@@ -27,6 +50,53 @@ func (e *Environment) Get(name string) (Object, bool) {
 }
 
 func (e *Environment) Set(name string, val Object) Object {
+	for i := len(e.names) - 1; i >= 0; i -= 1 {
+		if e.names[i] == name {
+			e.slots[i] = val
+			return val
+		}
+	}
+
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
+
 	e.store[name] = val
 	return val
 }
+
+// GetAt returns the variable depth environments out, in slot slot, or
+// looked up by name there when slot is negative. A slot that hasn't been
+// set yet falls back to a lookup by name, which is what a let reading the
+// outer variable it's about to shadow expects.
+func (e *Environment) GetAt(depth, slot int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0 && env.outer != nil; depth -= 1 {
+		env = env.outer
+	}
+
+	if depth > 0 || slot >= len(env.slots) {
+		return e.Get(name)
+	}
+
+	if slot < 0 {
+		return env.Get(name)
+	}
+
+	if obj := env.slots[slot]; obj != nil {
+		return obj, true
+	}
+
+	return e.Get(name)
+}
+
+// SetAt sets slot slot of e, falling back to a set by name if e has no such
+// slot.
+func (e *Environment) SetAt(slot int, name string, val Object) Object {
+	if slot < 0 || slot >= len(e.slots) {
+		return e.Set(name, val)
+	}
+
+	e.slots[slot] = val
+	return val
+}
@@ -0,0 +1,183 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// maxFormatWidth is the largest width or precision a verb can have, the
+// same as fmt's, which formats larger ones as an error instead.
+const maxFormatWidth = 1_000_000
+
+// formatVerbs lists the verbs Format knows and the types of argument each
+// takes, with a nil list meaning any.
+var formatVerbs = map[byte][]ObjectType{
+	'v': nil,
+	's': nil,
+	'q': {STRING_OBJ},
+	'd': {INTEGER_OBJ},
+	'b': {INTEGER_OBJ},
+	'o': {INTEGER_OBJ},
+	'x': {INTEGER_OBJ, STRING_OBJ},
+	'X': {INTEGER_OBJ, STRING_OBJ},
+	'f': {FLOAT_OBJ, INTEGER_OBJ},
+	'e': {FLOAT_OBJ, INTEGER_OBJ},
+	'g': {FLOAT_OBJ, INTEGER_OBJ},
+}
+
+// Format formats args according to format, like Go's fmt.Sprintf. A verb
+// can have the flags -, +, space, 0 and #, a width and a precision, as in
+// "%-10s %5d %.2f". %v and %s format any value the way print does, %q quotes
+// a string, %d, %b, %o, %x and %X format an integer, %x and %X a string's
+// bytes too, and %f, %e and %g a float, or an integer as one. %% is a
+// literal percent sign.
+//
+// Unlike fmt.Sprintf, a verb that doesn't suit its argument, a missing
+// argument or one left over is an error, and so is a width or a precision
+// over a million. The padding a width or precision asks for is counted
+// towards ctx's allocation limit, see Allocate, before it's made.
+func Format(ctx context.Context, format string, args []Object) (string, *Error) {
+	var out strings.Builder
+	next := 0
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			out.WriteByte(format[i])
+			continue
+		}
+
+		start := i
+		for i++; i < len(format) && strings.IndexByte("-+ 0#", format[i]) >= 0; i++ {
+		}
+
+		width, end, widthOk := formatNumber(format, i)
+		precision, precisionOk := 0, true
+		if i = end; i < len(format) && format[i] == '.' {
+			precision, i, precisionOk = formatNumber(format, i+1)
+		}
+
+		if i == len(format) {
+			return "", newError("format %q ends with an incomplete verb %s", format, format[start:])
+		}
+
+		verb := format[i]
+		spec := format[start : i+1]
+
+		switch {
+		case !widthOk:
+			return "", newError("format %q: the width of %s is over %d", format, spec, maxFormatWidth)
+		case !precisionOk:
+			return "", newError("format %q: the precision of %s is over %d", format, spec, maxFormatWidth)
+		}
+
+		if verb == '%' {
+			if spec != "%%" {
+				return "", newError("format %q: %s can't have flags, a width or a precision", format, spec)
+			}
+			out.WriteByte('%')
+			continue
+		}
+
+		types, ok := formatVerbs[verb]
+		if !ok {
+			return "", newError("format %q: unknown verb %s", format, spec)
+		}
+
+		if next == len(args) {
+			return "", newError("format %q: missing argument for %s", format, spec)
+		}
+		arg := args[next]
+		next++
+
+		if types != nil && !slices.Contains(types, arg.Type()) {
+			return "", newError("format %q: %s needs %s, got %s", format, spec, typeList(types), arg.Type())
+		}
+
+		if padding := width + precision; padding > 0 {
+			if err := Allocate(ctx, int64(padding)); err != nil {
+				return "", &Error{Message: err.Error(), Err: err}
+			}
+		}
+
+		out.WriteString(fmt.Sprintf(spec, formatValue(arg, verb)))
+	}
+
+	switch extra := len(args) - next; {
+	case extra == 1:
+		return "", newError("format %q: 1 argument left over", format)
+	case extra > 1:
+		return "", newError("format %q: %d arguments left over", format, extra)
+	}
+
+	return out.String(), nil
+}
+
+// formatValue returns the Go value to format arg with, once it's known verb
+// suits it.
+func formatValue(arg Object, verb byte) any {
+	switch arg := arg.(type) {
+
+	case *Integer:
+		switch verb {
+		case 'f', 'e', 'g':
+			return float64(arg.Value)
+		case 's':
+			return arg.Inspect()
+		default:
+			return arg.Value
+		}
+
+	case *Float:
+		switch verb {
+		case 'f', 'e', 'g':
+			return arg.Value
+		default:
+			return arg.Inspect()
+		}
+
+	case *String:
+		return arg.Value
+
+	default:
+		return arg.Inspect()
+	}
+}
+
+// formatNumber reads the width or precision starting at i in format,
+// returning it, where it ends and false if it's over maxFormatWidth.
+func formatNumber(format string, i int) (int, int, bool) {
+	n, ok := 0, true
+	for ; i < len(format) && isDigit(format[i]); i++ {
+		if n = n*10 + int(format[i]-'0'); n > maxFormatWidth {
+			// keep reading the digits, but stop counting
+			n, ok = maxFormatWidth, false
+		}
+	}
+
+	return n, i, ok
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// typeList names types the way an error message would: "an INTEGER" or
+// "an INTEGER or a STRING".
+func typeList(types []ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = article(string(t)) + " " + string(t)
+	}
+
+	return strings.Join(names, " or ")
+}
+
+func article(word string) string {
+	if strings.IndexByte("AEIOU", word[0]) >= 0 {
+		return "an"
+	}
+
+	return "a"
+}
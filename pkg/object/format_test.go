@@ -0,0 +1,86 @@
+package object
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	str := func(s string) Object { return &String{Value: s} }
+	integer := func(i int64) Object { return &Integer{Value: i} }
+
+	tests := []struct {
+		format   string
+		args     []Object
+		expected string
+	}{
+		{"%-10s|%5d|%.2f", []Object{str("ana"), integer(42), integer(3)}, "ana       |   42|3.00"},
+		{"%05d %+d %x %X %#o %b", []Object{integer(42), integer(7), integer(255), integer(255), integer(8), integer(5)}, "00042 +7 ff FF 010 101"},
+		{"%q %x %.2s", []Object{str(`say "hi"`), str("hi"), str("hello")}, `"say \"hi\"" 6869 he`},
+		{"%v %v %s %v", []Object{integer(1), TRUE, NULL, &Array{Elements: []Object{integer(1), str("a")}}}, "1 true null [1, a]"},
+		{"%6v|%-6v|", []Object{integer(12), TRUE}, "    12|true  |"},
+		{"100%%", nil, "100%"},
+	}
+
+	for _, tt := range tests {
+		got, err := Format(context.Background(), tt.format, tt.args)
+		if err != nil {
+			t.Errorf("unexpected error formatting %q: %s", tt.format, err.Message)
+			continue
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result formatting %q. want %q, got %q", tt.format, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	tests := []struct {
+		format   string
+		args     []Object
+		expected string
+	}{
+		{"%d", []Object{&String{Value: "a"}}, `format "%d": %d needs an INTEGER, got STRING`},
+		{"%5.1f", []Object{TRUE}, `format "%5.1f": %5.1f needs a FLOAT or an INTEGER, got BOOLEAN`},
+		{"%x", []Object{NULL}, `format "%x": %x needs an INTEGER or a STRING, got NULL`},
+		{"%q", []Object{&Integer{Value: 1}}, `format "%q": %q needs a STRING, got INTEGER`},
+		{"%s %s", []Object{TRUE}, `format "%s %s": missing argument for %s`},
+		{"%s", []Object{TRUE, TRUE}, `format "%s": 1 argument left over`},
+		{"%s", []Object{TRUE, TRUE, TRUE}, `format "%s": 2 arguments left over`},
+		{"%y", []Object{TRUE}, `format "%y": unknown verb %y`},
+		{"50%", nil, `format "50%" ends with an incomplete verb %`},
+		{"%-5", nil, `format "%-5" ends with an incomplete verb %-5`},
+		{"%5%", nil, `format "%5%": %5% can't have flags, a width or a precision`},
+		{"[%100000000d]", []Object{&Integer{Value: 1}}, `format "[%100000000d]": the width of %100000000d is over 1000000`},
+		{"%.99999999999999999999f", []Object{&Float{Value: 1}}, `format "%.99999999999999999999f": the precision of %.99999999999999999999f is over 1000000`},
+	}
+
+	for _, tt := range tests {
+		_, err := Format(context.Background(), tt.format, tt.args)
+		if err == nil {
+			t.Errorf("expected an error formatting %q", tt.format)
+			continue
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("wrong error formatting %q. want %q, got %q", tt.format, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestFormatAllocates(t *testing.T) {
+	var allocated int64
+	ctx := WithAllocator(context.Background(), func(size int64) error {
+		allocated += size
+		return nil
+	})
+
+	if _, err := Format(ctx, "%1000d|%5.300f", []Object{&Integer{Value: 1}, &Float{Value: 1}}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Message)
+	}
+
+	if allocated != 1305 {
+		t.Errorf("wrong size allocated. want %d, got %d", 1305, allocated)
+	}
+}
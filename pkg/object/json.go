@@ -0,0 +1,311 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// jsonModule is the json module, converting between values and JSON text.
+var jsonModule = mustModule("json", map[string]any{
+	"parse":     &Builtin{Fn: jsonParse},
+	"stringify": &Builtin{Fn: jsonStringify},
+})
+
+// jsonParse parses a JSON document. Objects become maps with their keys in
+// the order they were written, and numbers become integers unless they have
+// a fraction or an exponent, or are too big for one.
+func jsonParse(args ...Object) Object {
+	if err := validateLength(1, args); err != nil {
+		return err
+	}
+
+	str, ok := args[0].(*String)
+	if !ok {
+		return newError("argument to `json.parse` not supported, got %s", args[0].Type())
+	}
+
+	dec := json.NewDecoder(strings.NewReader(str.Value))
+	dec.UseNumber()
+
+	value, err := parseJSONValue(dec)
+	if err == nil {
+		if _, err = dec.Token(); err == io.EOF {
+			return value
+		} else if err == nil {
+			err = errors.New("unexpected data after the top-level value")
+		}
+	}
+
+	if err == io.EOF {
+		err = errors.New("unexpected end of JSON input")
+	}
+
+	return &Error{Message: fmt.Sprintf("invalid JSON: %s", err), Err: err}
+}
+
+func parseJSONValue(dec *json.Decoder) (Object, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+
+	case nil:
+		return NULL, nil
+
+	case bool:
+		return NativeBoolToBooleanObject(tok), nil
+
+	case string:
+		return &String{Value: tok}, nil
+
+	case json.Number:
+		return parseJSONNumber(tok)
+
+	case json.Delim:
+		if tok == '[' {
+			return parseJSONArray(dec)
+		}
+		return parseJSONObject(dec)
+
+	default:
+		return nil, fmt.Errorf("unexpected token %v", tok)
+	}
+}
+
+func parseJSONNumber(num json.Number) (Object, error) {
+	if !strings.ContainsAny(num.String(), ".eE") {
+		if value, err := num.Int64(); err == nil {
+			return &Integer{Value: value}, nil
+		}
+	}
+
+	value, err := num.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("number %s out of range", num)
+	}
+
+	return &Float{Value: value}, nil
+}
+
+func parseJSONArray(dec *json.Decoder) (Object, error) {
+	elements := []Object{}
+
+	for dec.More() {
+		el, err := parseJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, el)
+	}
+
+	// the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return &Array{Elements: elements}, nil
+}
+
+func parseJSONObject(dec *json.Decoder) (Object, error) {
+	m := NewMap()
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		key := &String{Value: tok.(string)}
+
+		value, err := parseJSONValue(dec)
+		if err != nil {
+			return nil, err
+		}
+
+		m.Set(key, value)
+	}
+
+	// the closing brace
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// jsonStringify writes a value as JSON, compact or, if given an indent,
+// either a number of spaces or a string, with one element per line. Maps
+// keep their order, sets become arrays and map keys that are integers,
+// floats or booleans become strings. Functions and other values JSON has no
+// counterpart for are an error, and so are cyclic values.
+func jsonStringify(args ...Object) Object {
+	if n := len(args); n < 1 || n > 2 {
+		return newError("wrong number of arguments: expected 1 or 2, got %d", n)
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *Integer:
+			if arg.Value < 0 || arg.Value > 10 {
+				return newError("indent to `json.stringify` must be between 0 and 10, got %d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *String:
+			indent = arg.Value
+		default:
+			return newError("indent to `json.stringify` must be INTEGER or STRING, got %s", arg.Type())
+		}
+	}
+
+	w := &jsonWriter{indent: indent, visiting: map[Object]bool{}}
+	if err := w.value(args[0], 0); err != nil {
+		return newError("cannot stringify: %s", err)
+	}
+
+	return &String{Value: w.buf.String()}
+}
+
+type jsonWriter struct {
+	buf      bytes.Buffer
+	indent   string
+	visiting map[Object]bool
+}
+
+func (w *jsonWriter) value(obj Object, depth int) error {
+	switch obj := obj.(type) {
+
+	case *Null:
+		w.buf.WriteString("null")
+
+	case *Boolean, *Integer:
+		w.buf.WriteString(obj.Inspect())
+
+	case *Float:
+		if math.IsInf(obj.Value, 0) || math.IsNaN(obj.Value) {
+			return fmt.Errorf("%s has no JSON representation", obj.Inspect())
+		}
+		w.buf.WriteString(obj.Inspect())
+
+	case *String:
+		w.string(obj.Value)
+
+	case *Array:
+		return w.elements(obj, obj.Elements, depth)
+
+	case *Set:
+		return w.elements(obj, obj.Items(), depth)
+
+	case *Map:
+		return w.object(obj, depth)
+
+	default:
+		return fmt.Errorf("%s has no JSON representation", obj.Type())
+	}
+
+	return nil
+}
+
+func (w *jsonWriter) elements(collection Object, elements []Object, depth int) error {
+	if err := w.enter(collection); err != nil {
+		return err
+	}
+	defer delete(w.visiting, collection)
+
+	w.buf.WriteByte('[')
+	for i, el := range elements {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.newline(depth + 1)
+
+		if err := w.value(el, depth+1); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+	}
+	if len(elements) > 0 {
+		w.newline(depth)
+	}
+	w.buf.WriteByte(']')
+
+	return nil
+}
+
+func (w *jsonWriter) object(m *Map, depth int) error {
+	if err := w.enter(m); err != nil {
+		return err
+	}
+	defer delete(w.visiting, m)
+
+	pairs := m.Items()
+
+	w.buf.WriteByte('{')
+	for i, pair := range pairs {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		w.newline(depth + 1)
+
+		switch key := pair.Key.(type) {
+		case *String:
+			w.string(key.Value)
+		case *Integer, *Float, *Boolean:
+			w.string(key.Inspect())
+		default:
+			return fmt.Errorf("%s can't be a JSON key", key.Type())
+		}
+
+		w.buf.WriteByte(':')
+		if w.indent != "" {
+			w.buf.WriteByte(' ')
+		}
+
+		if err := w.value(pair.Value, depth+1); err != nil {
+			return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+		}
+	}
+	if len(pairs) > 0 {
+		w.newline(depth)
+	}
+	w.buf.WriteByte('}')
+
+	return nil
+}
+
+// enter marks collection as being written, failing if it already is, which
+// means it contains itself.
+func (w *jsonWriter) enter(collection Object) error {
+	if w.visiting[collection] {
+		return fmt.Errorf("cyclic %s", collection.Type())
+	}
+	w.visiting[collection] = true
+
+	return nil
+}
+
+func (w *jsonWriter) newline(depth int) {
+	if w.indent == "" {
+		return
+	}
+
+	w.buf.WriteByte('\n')
+	for range depth {
+		w.buf.WriteString(w.indent)
+	}
+}
+
+func (w *jsonWriter) string(s string) {
+	enc := json.NewEncoder(&w.buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+
+	// Encode ends what it writes with a newline
+	w.buf.Truncate(w.buf.Len() - 1)
+}
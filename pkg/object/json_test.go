@@ -0,0 +1,121 @@
+package object
+
+import "testing"
+
+func TestJSONParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": [true, null, 2.5, "x"], "c": {}}`, "{b: 1, a: [true, null, 2.5, x], c: {}}"},
+		{`[]`, "[]"},
+		{`  42 `, "42"},
+		{`1e3`, "1000.0"},
+		{`-0.5`, "-0.5"},
+		{`12345678901234567890`, "1.2345678901234567e+19"},
+		{`"a\nb é"`, "a\nb é"},
+	}
+
+	for _, tt := range tests {
+		obj := jsonParse(&String{Value: tt.input})
+		if errObj, ok := obj.(*Error); ok {
+			t.Errorf("unexpected error parsing %q: %s", tt.input, errObj.Message)
+			continue
+		}
+
+		if got := obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong result parsing %q. want %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a": }`, "invalid JSON: missing value after object key"},
+		{`[1, 2`, "invalid JSON: unexpected end of JSON input"},
+		{``, "invalid JSON: unexpected end of JSON input"},
+		{`{"a" 1}`, "invalid JSON: invalid character '1' after object key"},
+		{`1 2`, "invalid JSON: unexpected data after the top-level value"},
+	}
+
+	for _, tt := range tests {
+		obj := jsonParse(&String{Value: tt.input})
+
+		errObj, ok := obj.(*Error)
+		if !ok {
+			t.Errorf("expected an error parsing %q, got %s", tt.input, obj.Inspect())
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error parsing %q. want %q, got %q", tt.input, tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	m := NewMap()
+	m.Set(&String{Value: "z"}, &Integer{Value: 1})
+	m.Set(&String{Value: "a"}, &Array{Elements: []Object{TRUE, NULL, &Float{Value: 2}, &String{Value: `<"é">`}}})
+	m.Set(&Integer{Value: 3}, NewMap())
+
+	set := NewSet()
+	set.Add(&Integer{Value: 1})
+
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{m}, `{"z":1,"a":[true,null,2.0,"<\"é\">"],"3":{}}`},
+		{[]Object{m, &Integer{Value: 2}}, "{\n  \"z\": 1,\n  \"a\": [\n    true,\n    null,\n    2.0,\n    \"<\\\"é\\\">\"\n  ],\n  \"3\": {}\n}"},
+		{[]Object{&Array{}, &String{Value: "\t"}}, "[]"},
+		{[]Object{set}, "[1]"},
+	}
+
+	for _, tt := range tests {
+		obj := jsonStringify(tt.args...)
+		if errObj, ok := obj.(*Error); ok {
+			t.Errorf("unexpected error: %s", errObj.Message)
+			continue
+		}
+
+		if got := obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong JSON. want %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestJSONStringifyErrors(t *testing.T) {
+	cyclic := &Array{}
+	cyclic.Elements = []Object{&Integer{Value: 1}, cyclic}
+
+	withFunction := NewMap()
+	withFunction.Set(&String{Value: "f"}, &Builtin{Fn: jsonParse})
+
+	tests := []struct {
+		args     []Object
+		expected string
+	}{
+		{[]Object{cyclic}, "cannot stringify: element 1: cyclic ARRAY"},
+		{[]Object{withFunction}, "cannot stringify: key f: BUILTIN has no JSON representation"},
+		{[]Object{&Array{Elements: []Object{&Float{Value: 1}, &Map{}}}, TRUE}, "indent to `json.stringify` must be INTEGER or STRING, got BOOLEAN"},
+		{nil, "wrong number of arguments: expected 1 or 2, got 0"},
+	}
+
+	for _, tt := range tests {
+		obj := jsonStringify(tt.args...)
+
+		errObj, ok := obj.(*Error)
+		if !ok {
+			t.Errorf("expected an error, got %s", obj.Inspect())
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error. want %q, got %q", tt.expected, errObj.Message)
+		}
+	}
+}
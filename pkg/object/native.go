@@ -0,0 +1,119 @@
+package object
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeFor[context.Context]()
+	errorType   = reflect.TypeFor[error]()
+)
+
+// NewNativeFunction wraps fn, a Go function, as a Builtin called name. The
+// arguments it's called with are converted to fn's parameter types with
+// ToGo, failing with an error naming the argument when they can't be, and
+// its result is converted back with FromGo.
+//
+// If fn's first parameter is a context.Context, it gets the context of the
+// run calling it. fn can return nothing, a value, an error, or a value and
+// an error. A non-nil error fails the call, with the error as the Err of the
+// *Error it returns, and so does a panic in fn, with a message naming it.
+func NewNativeFunction(name string, fn any) (*Builtin, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%s must be a function, got %T", name, fn)
+	}
+
+	t := v.Type()
+
+	takesContext := t.NumIn() > 0 && t.In(0) == contextType
+	firstParam := 0
+	if takesContext {
+		firstParam = 1
+	}
+
+	returnsError := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	returnsValue := t.NumOut() == 2 || t.NumOut() == 1 && !returnsError
+	if t.NumOut() > 2 || t.NumOut() == 2 && !returnsError {
+		return nil, fmt.Errorf("%s must return at most a value and an error, got %s", name, t)
+	}
+
+	params := make([]reflect.Type, 0, t.NumIn()-firstParam)
+	for i := firstParam; i < t.NumIn(); i++ {
+		params = append(params, t.In(i))
+	}
+
+	call := func(ctx context.Context, args ...Object) (result Object) {
+		in, errObj := nativeArguments(name, params, t.IsVariadic(), args)
+		if errObj != nil {
+			return errObj
+		}
+
+		if takesContext {
+			in = append([]reflect.Value{reflect.ValueOf(&ctx).Elem()}, in...)
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("panic in `%s`: %v", name, r)
+			}
+		}()
+
+		out := v.Call(in)
+
+		if returnsError {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return &Error{Message: err.Error(), Err: err}
+			}
+		}
+
+		if !returnsValue {
+			return NULL
+		}
+
+		obj, err := fromGo(out[0], map[uintptr]bool{})
+		if err != nil {
+			return newError("result of `%s`: %s", name, err)
+		}
+
+		return obj
+	}
+
+	return &Builtin{ContextFn: call}, nil
+}
+
+// nativeArguments converts args to the types of params, the last of which
+// takes any number of arguments if variadic is set.
+func nativeArguments(name string, params []reflect.Type, variadic bool, args []Object) ([]reflect.Value, *Error) {
+	fixed := len(params)
+	if variadic {
+		fixed -= 1
+	}
+
+	switch n := len(args); {
+	case variadic && n < fixed:
+		return nil, newError("wrong number of arguments: expected at least %d, got %d", fixed, n)
+	case !variadic && n != fixed:
+		return nil, newError("wrong number of arguments: expected %d, got %d", fixed, n)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var param reflect.Type
+		if i < fixed {
+			param = params[i]
+		} else {
+			param = params[fixed].Elem()
+		}
+
+		value := reflect.New(param)
+		if err := ToGo(arg, value.Interface()); err != nil {
+			return nil, newError("argument %d to `%s` not supported: %s", i+1, name, err)
+		}
+		in[i] = value.Elem()
+	}
+
+	return in, nil
+}
@@ -2,11 +2,19 @@ package object
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"io"
+	"math"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/token"
 )
 
 type ObjectType string
@@ -18,12 +26,19 @@ const (
 	BUILTIN_OBJ      = "BUILTIN"
 	FUNCTION_OBJ     = "FUNCTION"
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	ARRAY_OBJ        = "ARRAY"
 	MAP_OBJ          = "MAP"
+	SET_OBJ          = "SET"
 	QUOTE_OBJ        = "QUOTE"
 	MACRO_OBJ        = "MACRO"
+	USER_TYPE_OBJ    = "USER_TYPE"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 type Object interface {
@@ -35,8 +50,6 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
-var stringHashCache = map[string]HashKey{}
-
 type BuiltinFunction func(args ...Object) Object
 
 // Null
@@ -53,6 +66,10 @@ func (n *Null) Inspect() string {
 // Error
 type Error struct {
 	Message string
+
+	// Err is the Go error that caused it, if any, like one of the limits
+	// being exceeded
+	Err error
 }
 
 func (e *Error) Type() ObjectType {
@@ -80,6 +97,37 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// Float
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect formats f with as many digits as it takes to read it back, and
+// always with a dot or an exponent, so 2.0 isn't mistaken for an integer.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+
+	return s + ".0"
+}
+
+// HashKey gives a whole number the key of the integer it equals, so 1.0 and
+// 1 are the same map key and set element.
+func (f *Float) HashKey() HashKey {
+	if value, ok := floatToInteger(f.Value); ok {
+		// -0.0 included, since it's 0
+		return (&Integer{Value: value}).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
 // Boolean
 type Boolean struct {
 	Value bool
@@ -119,17 +167,27 @@ func (s *String) Inspect() string {
 }
 
 func (s *String) HashKey() HashKey {
-	if key, ok := stringHashCache[s.Value]; ok {
-		return key
-	}
-
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
 
-	key := HashKey{Type: s.Type(), Value: h.Sum64()}
-	stringHashCache[s.Value] = key
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+// RuneAt returns the rune at index, counting runes rather than bytes, as a
+// string of its own, or false if there's no such rune.
+func (s *String) RuneAt(index int64) (*String, bool) {
+	if index < 0 {
+		return nil, false
+	}
+
+	for _, r := range s.Value {
+		if index == 0 {
+			return &String{Value: string(r)}, true
+		}
+		index--
+	}
 
-	return key
+	return nil, false
 }
 
 // Array
@@ -156,9 +214,21 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+func (ao *Array) HashKey() HashKey {
+	h := fnv.New64a()
+
+	for _, el := range ao.Elements {
+		writeHashKey(h, el)
+	}
+
+	return HashKey{Type: ao.Type(), Value: h.Sum64()}
+}
+
 // Map
 type Map struct {
-	Pairs map[HashKey]HashPair
+	Pairs    map[HashKey]HashPair
+	UserType *UserType
+	order    []HashKey
 }
 
 type HashKey struct {
@@ -171,18 +241,106 @@ type HashPair struct {
 	Value Object
 }
 
+func NewMap() *Map {
+	return &Map{Pairs: make(map[HashKey]HashPair)}
+}
+
 func (m *Map) Type() ObjectType {
 	return MAP_OBJ
 }
 
+func (m *Map) HashKey() HashKey {
+	var value uint64
+
+	for _, pair := range m.Pairs {
+		h := fnv.New64a()
+		writeHashKey(h, pair.Key)
+		writeHashKey(h, pair.Value)
+		value += h.Sum64()
+	}
+
+	return HashKey{Type: m.Type(), Value: value}
+}
+
+func (m *Map) Get(key Hashable) (HashPair, bool) {
+	hash := key.HashKey()
+
+	for {
+		pair, ok := m.Pairs[hash]
+		if !ok {
+			return HashPair{}, false
+		}
+
+		if Equal(pair.Key, key.(Object)) {
+			return pair, true
+		}
+
+		hash.Value += 1
+	}
+}
+
+func (m *Map) Set(key Hashable, value Object) {
+	hash := key.HashKey()
+
+	for {
+		pair, ok := m.Pairs[hash]
+		if !ok {
+			m.order = append(m.order, hash)
+			break
+		}
+
+		if Equal(pair.Key, key.(Object)) {
+			break
+		}
+
+		hash.Value += 1
+	}
+
+	m.Pairs[hash] = HashPair{Key: key.(Object), Value: value}
+}
+
+// Items returns the pairs in insertion order. Pairs that were placed in
+// Pairs directly, bypassing Set, come last, sorted by key.
+func (m *Map) Items() []HashPair {
+	items := make([]HashPair, 0, len(m.Pairs))
+	seen := make(map[HashKey]bool, len(m.order))
+
+	for _, hash := range m.order {
+		if pair, ok := m.Pairs[hash]; ok && !seen[hash] {
+			items = append(items, pair)
+			seen[hash] = true
+		}
+	}
+
+	if len(items) == len(m.Pairs) {
+		return items
+	}
+
+	rest := make([]HashPair, 0, len(m.Pairs)-len(items))
+	for hash, pair := range m.Pairs {
+		if !seen[hash] {
+			rest = append(rest, pair)
+		}
+	}
+
+	slices.SortFunc(rest, func(a, b HashPair) int {
+		return Compare(a.Key, b.Key)
+	})
+
+	return append(items, rest...)
+}
+
 func (m *Map) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := make([]string, 0, len(m.Pairs))
-	for _, pair := range m.Pairs {
+	for _, pair := range m.Items() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
+	if m.UserType != nil {
+		out.WriteString(m.UserType.Name)
+	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
@@ -190,6 +348,157 @@ func (m *Map) Inspect() string {
 	return out.String()
 }
 
+// UserType
+type UserType struct {
+	Name    string
+	Methods map[string]Object
+}
+
+func (ut *UserType) Type() ObjectType {
+	return USER_TYPE_OBJ
+}
+
+func (ut *UserType) Inspect() string {
+	return fmt.Sprintf("type %s", ut.Name)
+}
+
+// BoundMethod
+type BoundMethod struct {
+	Receiver Object
+	Method   Object
+}
+
+func (bm *BoundMethod) Type() ObjectType {
+	return BOUND_METHOD_OBJ
+}
+
+func (bm *BoundMethod) Inspect() string {
+	return fmt.Sprintf("bound method of %s", bm.Receiver.Inspect())
+}
+
+// Set
+type Set struct {
+	Elements map[HashKey]Object
+	order    []HashKey
+}
+
+func NewSet() *Set {
+	return &Set{Elements: make(map[HashKey]Object)}
+}
+
+func (s *Set) Type() ObjectType {
+	return SET_OBJ
+}
+
+func (s *Set) Inspect() string {
+	var out bytes.Buffer
+
+	if len(s.Elements) == 0 {
+		return "set()"
+	}
+
+	elements := make([]string, 0, len(s.Elements))
+	for _, el := range s.Items() {
+		elements = append(elements, el.Inspect())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (s *Set) HashKey() HashKey {
+	var value uint64
+
+	for _, el := range s.Elements {
+		h := fnv.New64a()
+		writeHashKey(h, el)
+		value += h.Sum64()
+	}
+
+	return HashKey{Type: s.Type(), Value: value}
+}
+
+func (s *Set) Has(key Hashable) bool {
+	_, ok := s.lookup(key)
+	return ok
+}
+
+func (s *Set) Add(key Hashable) {
+	hash, ok := s.lookup(key)
+	if ok {
+		return
+	}
+
+	s.Elements[hash] = key.(Object)
+	s.order = append(s.order, hash)
+}
+
+func (s *Set) Items() []Object {
+	items := make([]Object, 0, len(s.Elements))
+	for _, hash := range s.order {
+		items = append(items, s.Elements[hash])
+	}
+
+	return items
+}
+
+func (s *Set) lookup(key Hashable) (HashKey, bool) {
+	hash := key.HashKey()
+
+	for {
+		el, ok := s.Elements[hash]
+		if !ok {
+			return hash, false
+		}
+
+		if Equal(el, key.(Object)) {
+			return hash, true
+		}
+
+		hash.Value += 1
+	}
+}
+
+// IsHashable reports whether obj can be used as a map key, which for arrays
+// and maps means every element they hold must be hashable too.
+func IsHashable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Integer, *Float, *Boolean, *String, *Set:
+		return true
+	case *Array:
+		for _, el := range obj.Elements {
+			if !IsHashable(el) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		for _, pair := range obj.Pairs {
+			if !IsHashable(pair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func writeHashKey(h io.Writer, obj Object) {
+	hashable, ok := obj.(Hashable)
+	if !ok {
+		h.Write([]byte(obj.Type()))
+		return
+	}
+
+	key := hashable.HashKey()
+	h.Write([]byte(key.Type))
+	binary.Write(h, binary.LittleEndian, key.Value)
+}
+
 // ReturnValue
 type ReturnValue struct {
 	Value Object
@@ -208,6 +517,7 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Scope      *ast.Scope
 }
 
 func (f *Function) Type() ObjectType {
@@ -231,9 +541,78 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	Positions     code.PositionTable
+	// Source is the literal the function was compiled from, used to turn
+	// it back into an AST node when it is unquoted.
+	Source *ast.FunctionLiteral
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("compiled function %s/%d", cf.Name, cf.NumParameters)
+}
+
+// Closure is a compiled function together with the free variables it
+// captured. It is the bytecode backend's counterpart of Function.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	if c.Fn.Name == "" {
+		return fmt.Sprintf("fn/%d", c.Fn.NumParameters)
+	}
+
+	return fmt.Sprintf("fn %s/%d", c.Fn.Name, c.Fn.NumParameters)
+}
+
+// Cell holds a local variable of a compiled function that closures
+// capture, shared by the function's frame and the closures so they all see
+// it change. Programs only ever see its value.
+type Cell struct {
+	Name string
+	// Value is nil until the variable is bound.
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
+func (c *Cell) Inspect() string {
+	return "cell " + c.Name
+}
+
 // Builtin
 type Builtin struct {
 	Fn BuiltinFunction
+
+	// ContextFn, if set, is called instead of Fn, with the context of the
+	// run calling it, so it can stop once the run is cancelled.
+	ContextFn func(ctx context.Context, args ...Object) Object
+}
+
+// Call calls the builtin with args as part of a run with ctx.
+func (b *Builtin) Call(ctx context.Context, args []Object) Object {
+	if b.ContextFn != nil {
+		return b.ContextFn(ctx, args...)
+	}
+
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType {
@@ -246,7 +625,8 @@ func (b *Builtin) Inspect() string {
 
 // Quote
 type Quote struct {
-	Node ast.Node
+	Node       ast.Node
+	Unhygienic bool
 }
 
 func (q *Quote) Type() ObjectType {
@@ -262,6 +642,7 @@ type Macro struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Pos        token.Position
 }
 
 func (m *Macro) Type() ObjectType {
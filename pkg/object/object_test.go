@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -22,21 +25,6 @@ func TestStringHashKey(t *testing.T) {
 	}
 }
 
-func TestStringHashCache(t *testing.T) {
-	s := "foo"
-	str := &String{Value: s}
-
-	if _, ok := stringHashCache[s]; ok {
-		t.Fatalf("string hash cache for value %q should be empty", s)
-	}
-
-	str.HashKey()
-
-	if _, ok := stringHashCache[s]; !ok {
-		t.Fatalf("string hash cache for value %q should be filled", s)
-	}
-}
-
 func TestIntegerHashKey(t *testing.T) {
 	one1 := &Integer{Value: 1}
 	one2 := &Integer{Value: 1}
@@ -57,6 +45,32 @@ func TestIntegerHashKey(t *testing.T) {
 	}
 }
 
+func TestFloatHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	oneFloat := &Float{Value: 1}
+	half := &Float{Value: 0.5}
+
+	if oneFloat.HashKey() != one.HashKey() {
+		t.Errorf("a whole float has a different hash key than the integer it equals")
+	}
+
+	if (&Float{Value: math.Copysign(0, -1)}).HashKey() != (&Integer{Value: 0}).HashKey() {
+		t.Errorf("-0.0 has a different hash key than 0")
+	}
+
+	if half.HashKey() == one.HashKey() {
+		t.Errorf("floats with different content have same hash keys")
+	}
+
+	if !Equal(one, oneFloat) || !Equal(oneFloat, one) {
+		t.Errorf("1 and 1.0 aren't equal")
+	}
+
+	if Equal(&Integer{Value: 1<<53 + 1}, &Float{Value: 1 << 53}) {
+		t.Errorf("2^53 + 1 is equal to the float it rounds to")
+	}
+}
+
 func TestBooleanHashKey(t *testing.T) {
 	true1 := &Boolean{Value: true}
 	true2 := &Boolean{Value: true}
@@ -76,3 +90,231 @@ func TestBooleanHashKey(t *testing.T) {
 		t.Errorf("booleans with different content have same hash keys")
 	}
 }
+
+func TestEqual(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+	bar := &String{Value: "bar"}
+
+	tests := []struct {
+		left     Object
+		right    Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, &Integer{Value: 1}, true},
+		{one, two, false},
+		{&String{Value: "bar"}, bar, true},
+		{one, bar, false},
+		{&Null{}, &Null{}, true},
+		{&Array{Elements: []Object{one, bar}}, &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "bar"}}}, true},
+		{&Array{Elements: []Object{one, bar}}, &Array{Elements: []Object{bar, one}}, false},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{
+			&Array{Elements: []Object{&Array{Elements: []Object{one}}}},
+			&Array{Elements: []Object{&Array{Elements: []Object{&Integer{Value: 1}}}}},
+			true,
+		},
+		{newTestMap(bar, one), newTestMap(&String{Value: "bar"}, &Integer{Value: 1}), true},
+		{newTestMap(bar, one), newTestMap(bar, two), false},
+		{newTestMap(bar, one), &Map{Pairs: newTestMap(bar, one).Pairs, UserType: &UserType{Name: "T"}}, false},
+		{&Function{}, &Function{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.left, tt.right); got != tt.expected {
+			t.Errorf("Equal(%s, %s) wrong. want %t, got %t", tt.left.Inspect(), tt.right.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestEqualCyclic(t *testing.T) {
+	left := &Array{}
+	left.Elements = []Object{&Integer{Value: 1}, left}
+
+	right := &Array{}
+	right.Elements = []Object{&Integer{Value: 1}, right}
+
+	if !Equal(left, right) {
+		t.Errorf("cyclic arrays with the same shape should be equal")
+	}
+
+	if Compare(left, right) != 0 {
+		t.Errorf("cyclic arrays with the same shape should compare as 0")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+
+	tests := []struct {
+		left     Object
+		right    Object
+		expected int
+	}{
+		{one, two, -1},
+		{two, one, 1},
+		{one, &Integer{Value: 1}, 0},
+		{&String{Value: "a"}, &String{Value: "b"}, -1},
+		{&Boolean{Value: false}, &Boolean{Value: true}, -1},
+		{&Null{}, &Boolean{Value: false}, -1},
+		{&Boolean{Value: true}, one, -1},
+		{one, &String{Value: "1"}, -1},
+		{&String{Value: "z"}, &Array{}, -1},
+		{&Array{}, newTestMap(one, one), -1},
+		{newTestMap(one, one), &Function{}, -1},
+		{&Array{Elements: []Object{one, two}}, &Array{Elements: []Object{one, one}}, 1},
+		{&Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, -1},
+		{newTestMap(one, one), newTestMap(one, two), -1},
+		{newTestMap(one, two), newTestMap(two, one), -1},
+	}
+
+	for _, tt := range tests {
+		if got := Compare(tt.left, tt.right); got != tt.expected {
+			t.Errorf("Compare(%s, %s) wrong. want %d, got %d", tt.left.Inspect(), tt.right.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func newTestMap(key Hashable, value Object) *Map {
+	return &Map{
+		Pairs: map[HashKey]HashPair{
+			key.HashKey(): {Key: key.(Object), Value: value},
+		},
+	}
+}
+
+func TestArrayHashKey(t *testing.T) {
+	pair1 := &Array{Elements: []Object{&Integer{Value: 2024}, &Integer{Value: 1}}}
+	pair2 := &Array{Elements: []Object{&Integer{Value: 2024}, &Integer{Value: 1}}}
+	swapped := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2024}}}
+	nested := &Array{Elements: []Object{pair1}}
+
+	if pair1.HashKey() != pair2.HashKey() {
+		t.Errorf("arrays with the same content have different hash keys")
+	}
+
+	if pair1.HashKey() == swapped.HashKey() {
+		t.Errorf("arrays with different element order have same hash keys")
+	}
+
+	if pair1.HashKey() == nested.HashKey() {
+		t.Errorf("nested array has the same hash key as its element")
+	}
+}
+
+func TestMapHashKey(t *testing.T) {
+	one := &Integer{Value: 1}
+	two := &Integer{Value: 2}
+
+	map1 := &Map{Pairs: map[HashKey]HashPair{}}
+	map1.Set(one, two)
+	map1.Set(two, one)
+
+	map2 := &Map{Pairs: map[HashKey]HashPair{}}
+	map2.Set(two, one)
+	map2.Set(one, two)
+
+	map3 := &Map{Pairs: map[HashKey]HashPair{}}
+	map3.Set(one, one)
+	map3.Set(two, two)
+
+	if map1.HashKey() != map2.HashKey() {
+		t.Errorf("maps with the same content have different hash keys")
+	}
+
+	if map1.HashKey() == map3.HashKey() {
+		t.Errorf("maps with different content have same hash keys")
+	}
+}
+
+func TestMapCollision(t *testing.T) {
+	key := &String{Value: "key"}
+	other := &String{Value: "other"}
+
+	// simulate other having collided into the slot key hashes to
+	m := &Map{
+		Pairs: map[HashKey]HashPair{
+			key.HashKey(): {Key: other, Value: &Integer{Value: 1}},
+		},
+	}
+
+	if _, ok := m.Get(key); ok {
+		t.Fatalf("Get returned a pair for a colliding key")
+	}
+
+	m.Set(key, &Integer{Value: 2})
+
+	if n := len(m.Pairs); n != 2 {
+		t.Fatalf("Set overwrote the colliding pair. got %d pairs", n)
+	}
+
+	pair, ok := m.Get(key)
+	if !ok {
+		t.Fatalf("Get didn't find the key after Set")
+	}
+
+	if value := pair.Value.(*Integer).Value; value != 2 {
+		t.Errorf("wrong value for key. want %d, got %d", 2, value)
+	}
+
+	m.Set(key, &Integer{Value: 3})
+
+	if n := len(m.Pairs); n != 2 {
+		t.Fatalf("Set didn't replace the existing pair. got %d pairs", n)
+	}
+}
+
+func TestIsHashable(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected bool
+	}{
+		{&Integer{Value: 1}, true},
+		{&String{Value: "a"}, true},
+		{&Boolean{Value: true}, true},
+		{&Null{}, false},
+		{&Function{}, false},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Array{}}}, true},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Function{}}}, false},
+		{newTestMap(&Integer{Value: 1}, &String{Value: "a"}), true},
+		{newTestMap(&Integer{Value: 1}, &Function{}), false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHashable(tt.obj); got != tt.expected {
+			t.Errorf("IsHashable(%s) wrong. want %t, got %t", tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	set := NewSet()
+	set.Add(&Integer{Value: 1})
+	set.Add(&Array{Elements: []Object{&Integer{Value: 2}}})
+	set.Add(&Integer{Value: 1})
+
+	if n := len(set.Elements); n != 2 {
+		t.Fatalf("set has wrong number of elements. got %d", n)
+	}
+
+	if !set.Has(&Array{Elements: []Object{&Integer{Value: 2}}}) {
+		t.Errorf("set doesn't contain an equal array")
+	}
+
+	if set.Has(&Integer{Value: 2}) {
+		t.Errorf("set contains an element that wasn't added")
+	}
+
+	other := NewSet()
+	other.Add(&Array{Elements: []Object{&Integer{Value: 2}}})
+	other.Add(&Integer{Value: 1})
+
+	if set.HashKey() != other.HashKey() {
+		t.Errorf("sets with the same elements have different hash keys")
+	}
+
+	if !Equal(set, other) {
+		t.Errorf("sets with the same elements are not equal")
+	}
+}
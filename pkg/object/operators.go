@@ -0,0 +1,271 @@
+package object
+
+import "strings"
+
+// derivedOperators are the comparisons a user type gets from defining only
+// == and <: calling the method with the operands swapped if swap is set,
+// and negating its result if negate is.
+var derivedOperators = map[string]struct {
+	method string
+	swap   bool
+	negate bool
+}{
+	"!=": {method: "==", swap: false, negate: true},
+	">":  {method: "<", swap: true, negate: false},
+	"<=": {method: "<", swap: true, negate: true},
+	">=": {method: "<", swap: false, negate: true},
+}
+
+// LookupMethod returns the method called name of obj's user type, if obj is
+// an instance of one and the type has it.
+func LookupMethod(obj Object, name string) (Object, bool) {
+	m, ok := obj.(*Map)
+	if !ok || m.UserType == nil {
+		return nil, false
+	}
+
+	method, ok := m.UserType.Methods[name]
+	return method, ok
+}
+
+// Overload returns the method of left's user type that implements
+// operator, either directly or derived from == or <, with the arguments to
+// call it with. If negate is set, the operator's result is the negation of
+// the method's truthiness. ok is false if left's type doesn't overload
+// operator, which Infix then applies.
+func Overload(operator string, left, right Object) (method Object, args []Object, negate bool, ok bool) {
+	if method, ok := LookupMethod(left, operator); ok {
+		return method, []Object{left, right}, false, true
+	}
+
+	derived, ok := derivedOperators[operator]
+	if !ok {
+		return nil, nil, false, false
+	}
+
+	method, ok = LookupMethod(left, derived.method)
+	if !ok {
+		return nil, nil, false, false
+	}
+
+	args = []Object{left, right}
+	if derived.swap {
+		args = []Object{right, left}
+	}
+
+	return method, args, derived.negate, true
+}
+
+// Prefix applies operator, ! or -, to right, returning an *Error if it
+// doesn't apply to right's type.
+func Prefix(operator string, right Object) Object {
+	switch operator {
+
+	case "!":
+		return NativeBoolToBooleanObject(right == NULL || right == FALSE)
+
+	case "-":
+		switch right := right.(type) {
+		case *Integer:
+			return &Integer{Value: -right.Value}
+		case *Float:
+			return &Float{Value: -right.Value}
+		}
+		return newError("unkown operator: -%s", right.Type())
+
+	default:
+		return newError("unkown operator: %s%s", operator, right.Type())
+	}
+}
+
+// Infix applies operator, an arithmetic operator, a comparison or in, to
+// left and right, returning an *Error if it doesn't apply to their types.
+// It doesn't look at user types' methods, which come first, see Overload.
+func Infix(operator string, left, right Object) Object {
+	// integers first, as they are by far the most common operands
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok && operator != "in" {
+			return integerInfix(operator, l, r)
+		}
+	}
+
+	switch {
+	case operator == "in":
+		return in(left, right)
+	case isNumber(left) && isNumber(right):
+		return floatInfix(operator, left, right)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringInfix(operator, left.(*String), right.(*String))
+	case left.Type() == ARRAY_OBJ && right.Type() == ARRAY_OBJ:
+		return arrayInfix(operator, left, right)
+	case operator == "==":
+		return NativeBoolToBooleanObject(Equal(left, right))
+	case operator == "!=":
+		return NativeBoolToBooleanObject(!Equal(left, right))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func integerInfix(operator string, left, right *Integer) Object {
+	l, r := left.Value, right.Value
+
+	switch operator {
+
+	// Arithmetic
+	case "+":
+		return &Integer{Value: l + r}
+	case "-":
+		return &Integer{Value: l - r}
+	case "*":
+		return &Integer{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("unsupported operation: division by zero")
+		}
+		return &Integer{Value: l / r}
+
+	// Boolean
+	case "<":
+		return NativeBoolToBooleanObject(l < r)
+	case ">":
+		return NativeBoolToBooleanObject(l > r)
+	case "==":
+		return NativeBoolToBooleanObject(l == r)
+	case "!=":
+		return NativeBoolToBooleanObject(l != r)
+	case "<=":
+		return NativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return NativeBoolToBooleanObject(l >= r)
+
+	default:
+		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// floatInfix operates on two numbers, at least one of them a float,
+// turning the other into a float if it isn't.
+func floatInfix(operator string, left, right Object) Object {
+	l, _ := ToFloat(left)
+	r, _ := ToFloat(right)
+
+	switch operator {
+
+	// Arithmetic
+	case "+":
+		return &Float{Value: l + r}
+	case "-":
+		return &Float{Value: l - r}
+	case "*":
+		return &Float{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("unsupported operation: division by zero")
+		}
+		return &Float{Value: l / r}
+
+	// Boolean
+	case "<":
+		return NativeBoolToBooleanObject(l < r)
+	case ">":
+		return NativeBoolToBooleanObject(l > r)
+	case "==":
+		return NativeBoolToBooleanObject(NumbersEqual(left, right))
+	case "!=":
+		return NativeBoolToBooleanObject(!NumbersEqual(left, right))
+	case "<=":
+		return NativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return NativeBoolToBooleanObject(l >= r)
+
+	default:
+		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj Object) bool {
+	_, ok := ToFloat(obj)
+	return ok
+}
+
+func stringInfix(operator string, left, right *String) Object {
+	l, r := left.Value, right.Value
+
+	switch operator {
+	case "+":
+		return &String{Value: l + r}
+	case "<":
+		return NativeBoolToBooleanObject(l < r)
+	case ">":
+		return NativeBoolToBooleanObject(l > r)
+	case "==":
+		return NativeBoolToBooleanObject(l == r)
+	case "!=":
+		return NativeBoolToBooleanObject(l != r)
+	case "<=":
+		return NativeBoolToBooleanObject(l <= r)
+	case ">=":
+		return NativeBoolToBooleanObject(l >= r)
+	default:
+		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func arrayInfix(operator string, left, right Object) Object {
+	switch operator {
+	case "==":
+		return NativeBoolToBooleanObject(Equal(left, right))
+	case "!=":
+		return NativeBoolToBooleanObject(!Equal(left, right))
+	case "<":
+		return NativeBoolToBooleanObject(Compare(left, right) < 0)
+	case ">":
+		return NativeBoolToBooleanObject(Compare(left, right) > 0)
+	case "<=":
+		return NativeBoolToBooleanObject(Compare(left, right) <= 0)
+	case ">=":
+		return NativeBoolToBooleanObject(Compare(left, right) >= 0)
+	default:
+		return newError("unkown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// in reports whether left is an element of a set or an array, a key of a
+// map or a substring of a string.
+func in(left, right Object) Object {
+	switch right := right.(type) {
+	case *Set:
+		if !IsHashable(left) {
+			return FALSE
+		}
+		return NativeBoolToBooleanObject(right.Has(left.(Hashable)))
+
+	case *Map:
+		if !IsHashable(left) {
+			return FALSE
+		}
+		_, ok := right.Get(left.(Hashable))
+		return NativeBoolToBooleanObject(ok)
+
+	case *Array:
+		for _, el := range right.Elements {
+			if Equal(left, el) {
+				return TRUE
+			}
+		}
+		return FALSE
+
+	case *String:
+		str, ok := left.(*String)
+		if !ok {
+			return newError("unkown operator: %s in %s", left.Type(), right.Type())
+		}
+		return NativeBoolToBooleanObject(strings.Contains(right.Value, str.Value))
+
+	default:
+		return newError("unkown operator: %s in %s", left.Type(), right.Type())
+	}
+}
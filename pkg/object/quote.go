@@ -0,0 +1,383 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+// Unquote replaces the unquote and unquote_splice calls in quoted with the
+// AST form of their arguments' values, using eval to evaluate them.
+func Unquote(quoted ast.Node, eval func(ast.Node) Object) (ast.Node, error) {
+	if err := evalUnquoteSpliceCalls(quoted, eval); err != nil {
+		return nil, err
+	}
+
+	var unquoteErr error
+
+	modified, err := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if unquoteErr != nil {
+			return node
+		}
+
+		if isUnquoteSpliceCall(node) {
+			unquoteErr = fmt.Errorf("unquote_splice can only be used inside arguments, arrays, sets and blocks")
+			return node
+		}
+
+		if !isUnquoteCall(node) {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			return node
+		}
+
+		converted, err := ToASTNode(eval(call.Arguments[0]))
+		if err != nil {
+			unquoteErr = err
+			return node
+		}
+
+		return converted
+	})
+
+	if unquoteErr != nil {
+		return nil, unquoteErr
+	}
+
+	return modified, err
+}
+
+// evalUnquoteSpliceCalls replaces every unquote_splice(...) found directly in
+// a list of arguments, elements or statements with the elements of the array
+// it evaluates to.
+func evalUnquoteSpliceCalls(quoted ast.Node, eval func(ast.Node) Object) error {
+	var spliceErr error
+
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		if spliceErr != nil || isUnquoteCall(node) {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.Program:
+			node.Statements, spliceErr = spliceStatements(node.Statements, eval)
+		case *ast.BlockStatement:
+			node.Statements, spliceErr = spliceStatements(node.Statements, eval)
+		case *ast.ArrayLiteral:
+			node.Elements, spliceErr = spliceExpressions(node.Elements, eval)
+		case *ast.SetLiteral:
+			node.Elements, spliceErr = spliceExpressions(node.Elements, eval)
+		case *ast.CallExpression:
+			node.Arguments, spliceErr = spliceExpressions(node.Arguments, eval)
+		}
+
+		return spliceErr == nil
+	})
+
+	return spliceErr
+}
+
+func spliceExpressions(exps []ast.Expression, eval func(ast.Node) Object) ([]ast.Expression, error) {
+	if !containsSplice(exps) {
+		return exps, nil
+	}
+
+	spliced := make([]ast.Expression, 0, len(exps))
+	for _, exp := range exps {
+		if !isUnquoteSpliceCall(exp) {
+			spliced = append(spliced, exp)
+			continue
+		}
+
+		nodes, err := evalUnquoteSplice(exp.(*ast.CallExpression), eval)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			exp, ok := node.(ast.Expression)
+			if !ok {
+				return nil, fmt.Errorf("cannot splice %s into an expression list", ASTKind(node))
+			}
+			spliced = append(spliced, exp)
+		}
+	}
+
+	return spliced, nil
+}
+
+func spliceStatements(stmts []ast.Statement, eval func(ast.Node) Object) ([]ast.Statement, error) {
+	spliced := make([]ast.Statement, 0, len(stmts))
+
+	for _, stmt := range stmts {
+		exprStmt, ok := stmt.(*ast.ExpressionStatement)
+		if !ok || !isUnquoteSpliceCall(exprStmt.Expression) {
+			spliced = append(spliced, stmt)
+			continue
+		}
+
+		nodes, err := evalUnquoteSplice(exprStmt.Expression.(*ast.CallExpression), eval)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case ast.Statement:
+				spliced = append(spliced, node)
+			case ast.Expression:
+				spliced = append(spliced, &ast.ExpressionStatement{Token: exprStmt.Token, Expression: node})
+			default:
+				return nil, fmt.Errorf("cannot splice %s into a block", ASTKind(node))
+			}
+		}
+	}
+
+	return spliced, nil
+}
+
+func evalUnquoteSplice(call *ast.CallExpression, eval func(ast.Node) Object) ([]ast.Node, error) {
+	if n := len(call.Arguments); n != 1 {
+		return nil, fmt.Errorf("wrong number of arguments to unquote_splice: expected 1, got %d", n)
+	}
+
+	evaluated := eval(call.Arguments[0])
+	if errObj, ok := evaluated.(*Error); ok {
+		return nil, fmt.Errorf("%s", errObj.Message)
+	}
+
+	arr, ok := evaluated.(*Array)
+	if !ok {
+		return nil, fmt.Errorf("unquote_splice expects an array, got %s", typeName(evaluated))
+	}
+
+	nodes := make([]ast.Node, 0, len(arr.Elements))
+	for _, el := range arr.Elements {
+		node, err := ToASTNode(el)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func containsSplice(exps []ast.Expression) bool {
+	for _, exp := range exps {
+		if isUnquoteSpliceCall(exp) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isUnquoteCall(node ast.Node) bool {
+	return isCallTo(node, "unquote")
+}
+
+func isUnquoteSpliceCall(node ast.Node) bool {
+	return isCallTo(node, "unquote_splice")
+}
+
+func isCallTo(node ast.Node, name string) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == name
+}
+
+// ToASTNode converts a value back into the AST literal that produces it.
+func ToASTNode(obj Object) (ast.Node, error) {
+	switch obj := obj.(type) {
+
+	case *Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+
+	case *Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, nil
+
+	case *Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+
+	case *String:
+		t := token.Token{
+			Type:    token.STRING,
+			Literal: obj.Value,
+		}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+
+	case *Null:
+		t := token.Token{
+			Type:    token.NULL,
+			Literal: "null",
+		}
+		return &ast.NullLiteral{Token: t}, nil
+
+	case *Array:
+		t := token.Token{
+			Type:    token.LBRACKET,
+			Literal: "[",
+		}
+
+		elems, err := convertObjectsToExpressions(obj.Elements)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ast.ArrayLiteral{Token: t, Elements: elems}, nil
+
+	case *Set:
+		elems, err := convertObjectsToExpressions(obj.Items())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(elems) == 0 {
+			t := token.Token{Type: token.LPAREN, Literal: "("}
+			return &ast.CallExpression{Token: t, Function: NewIdentifier("set")}, nil
+		}
+
+		t := token.Token{
+			Type:    token.LBRACE,
+			Literal: "{",
+		}
+		return &ast.SetLiteral{Token: t, Elements: elems}, nil
+
+	case *Map:
+		t := token.Token{
+			Type:    token.LBRACE,
+			Literal: "{",
+		}
+
+		pairs := make([]*ast.MapPair, 0, len(obj.Pairs))
+		for _, pair := range obj.Items() {
+			key, err := convertObjectToExpression(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := convertObjectToExpression(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			pairs = append(pairs, &ast.MapPair{Key: key, Value: value})
+		}
+
+		return &ast.MapLiteral{Token: t, Pairs: pairs}, nil
+
+	case *Function:
+		t := token.Token{
+			Type:    token.FUNCTION,
+			Literal: "fn",
+		}
+		function := &ast.FunctionLiteral{
+			Token:      t,
+			Parameters: obj.Parameters,
+			Body:       obj.Body,
+		}
+		return ast.Copy(function), nil
+
+	case *Closure:
+		if obj.Fn.Source == nil {
+			return nil, fmt.Errorf("cannot convert %s to an AST node", typeName(obj))
+		}
+		return ast.Copy(obj.Fn.Source), nil
+
+	case *Quote:
+		return obj.Node, nil
+
+	case *Error:
+		return nil, fmt.Errorf("%s", obj.Message)
+
+	default:
+		return nil, fmt.Errorf("cannot convert %s to an AST node", typeName(obj))
+	}
+}
+
+func convertObjectToExpression(obj Object) (ast.Expression, error) {
+	node, err := ToASTNode(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		return nil, fmt.Errorf("cannot use %s as an expression", ASTKind(node))
+	}
+
+	return exp, nil
+}
+
+func convertObjectsToExpressions(objs []Object) ([]ast.Expression, error) {
+	exps := make([]ast.Expression, 0, len(objs))
+
+	for _, obj := range objs {
+		exp, err := convertObjectToExpression(obj)
+		if err != nil {
+			return nil, err
+		}
+		exps = append(exps, exp)
+	}
+
+	return exps, nil
+}
+
+// ASTKind names a node's type without its package, e.g. "InfixExpression".
+func ASTKind(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+// gensymCounter numbers the names made by FreshName. Generated names are
+// the prefix, a # and a number, which the lexer never reads as an
+// identifier, so they can't clash with names programs write.
+// It's shared by every program in the process, so names made for different
+// programs never clash either.
+var gensymCounter atomic.Int64
+
+func FreshName(prefix string) string {
+	return fmt.Sprintf("%s#%d", prefix, gensymCounter.Add(1))
+}
+
+func NewIdentifier(name string) *ast.Identifier {
+	return &ast.Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: name},
+		Value: name,
+	}
+}
+
+func typeName(obj Object) ObjectType {
+	if obj == nil {
+		return NULL_OBJ
+	}
+
+	return obj.Type()
+}
@@ -0,0 +1,266 @@
+package object
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+)
+
+// MaxBuiltins is how many builtins, registered functions and modules
+// included, a Runtime can have, since compiled code refers to them with a
+// single byte.
+const MaxBuiltins = 1 << 8
+
+// Runtime holds what a program can reach besides its own values: the
+// builtins it can call and the streams they use. Nothing in a Runtime is
+// shared with other Runtimes, so programs on different Runtimes can run at
+// the same time. A Runtime should only run one program at a time, and its
+// fields should be set, and its functions registered, before it does.
+type Runtime struct {
+	// Stdout is where print, println, printf and input write to, and
+	// Stderr where eprint and eprintln do, os.Stdout and os.Stderr by
+	// default.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Stdin is what readLine and input read from, os.Stdin by default. It's
+	// buffered once first read, so it shouldn't be changed after that.
+	Stdin io.Reader
+	stdin *bufio.Reader
+
+	// Expand is how macroexpand and macroexpand1 expand the macro calls in
+	// node: all of them, or with all unset only one at the top of node, by
+	// one step. They fail while it's nil.
+	Expand func(ctx context.Context, node ast.Node, all bool) (ast.Node, error)
+
+	// names and builtins hold the builtins in the order of Builtins,
+	// followed by the functions and modules registered, in the order they
+	// were, with index mapping a name to its position.
+	names    []string
+	builtins []Object
+	index    map[string]int
+}
+
+// runtimeBuiltins make the builtins that use their Runtime, replacing the
+// ones with the same name in Builtins, which use the process' streams.
+var runtimeBuiltins = map[string]func(rt *Runtime) *Builtin{
+	"print":    func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.print} },
+	"println":  func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.println} },
+	"eprint":   func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.eprint} },
+	"eprintln": func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.eprintln} },
+	"printf":   func(rt *Runtime) *Builtin { return &Builtin{ContextFn: rt.printf} },
+	"readLine": func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.readLine} },
+	"input":    func(rt *Runtime) *Builtin { return &Builtin{Fn: rt.input} },
+
+	"macroexpand":  func(rt *Runtime) *Builtin { return &Builtin{ContextFn: rt.macroExpander("macroexpand", true)} },
+	"macroexpand1": func(rt *Runtime) *Builtin { return &Builtin{ContextFn: rt.macroExpander("macroexpand1", false)} },
+}
+
+func NewRuntime() *Runtime {
+	rt := &Runtime{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Stdin:  os.Stdin,
+		index:  make(map[string]int, len(Builtins)),
+	}
+
+	for _, def := range Builtins {
+		value := def.Value
+		if bind, ok := runtimeBuiltins[def.Name]; ok {
+			value = bind(rt)
+		}
+
+		rt.define(def.Name, value)
+	}
+
+	return rt
+}
+
+// RegisterFunc makes fn, a Go function, callable by programs as name,
+// wrapping it with NewNativeFunction. Registering a name again, a builtin's
+// included, replaces it.
+func (rt *Runtime) RegisterFunc(name string, fn any) error {
+	builtin, err := NewNativeFunction(name, fn)
+	if err != nil {
+		return err
+	}
+
+	return rt.register(name, builtin)
+}
+
+// RegisterModule makes a map called name with members available to
+// programs, so they can call a function like db.query(...). Functions are
+// wrapped with NewNativeFunction and other values converted with FromGo.
+func (rt *Runtime) RegisterModule(name string, members map[string]any) error {
+	module, err := newModule(name, members)
+	if err != nil {
+		return err
+	}
+
+	return rt.register(name, module)
+}
+
+// newModule returns a map from the names of members to their values, with
+// functions wrapped as builtins called name.member.
+func newModule(name string, members map[string]any) (*Map, error) {
+	module := NewMap()
+
+	memberNames := make([]string, 0, len(members))
+	for member := range members {
+		memberNames = append(memberNames, member)
+	}
+	slices.Sort(memberNames)
+
+	for _, member := range memberNames {
+		value, err := moduleMember(name+"."+member, members[member])
+		if err != nil {
+			return nil, err
+		}
+
+		module.Set(&String{Value: member}, value)
+	}
+
+	return module, nil
+}
+
+// mustModule is like newModule, but panics if a member can't be wrapped, for
+// the standard modules.
+func mustModule(name string, members map[string]any) *Map {
+	module, err := newModule(name, members)
+	if err != nil {
+		panic(err)
+	}
+
+	return module
+}
+
+func moduleMember(name string, value any) (Object, error) {
+	if fn, ok := value.(Object); ok {
+		return fn, nil
+	}
+
+	if reflect.TypeOf(value) != nil && reflect.TypeOf(value).Kind() == reflect.Func {
+		return NewNativeFunction(name, value)
+	}
+
+	obj, err := FromGo(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return obj, nil
+}
+
+func (rt *Runtime) register(name string, value Object) error {
+	if _, ok := rt.index[name]; !ok && len(rt.builtins) >= MaxBuiltins {
+		return fmt.Errorf("cannot register %s: a runtime can't have more than %d builtins", name, MaxBuiltins)
+	}
+
+	rt.define(name, value)
+	return nil
+}
+
+func (rt *Runtime) define(name string, value Object) {
+	if idx, ok := rt.index[name]; ok {
+		rt.builtins[idx] = value
+		return
+	}
+
+	rt.index[name] = len(rt.builtins)
+	rt.names = append(rt.names, name)
+	rt.builtins = append(rt.builtins, value)
+}
+
+// Builtin returns the builtin, registered function or module called name.
+func (rt *Runtime) Builtin(name string) (Object, bool) {
+	idx, ok := rt.index[name]
+	if !ok {
+		return nil, false
+	}
+
+	return rt.builtins[idx], true
+}
+
+// BuiltinAt returns the builtin at index in BuiltinNames, which is how
+// compiled code refers to builtins, or an *Error if there's none there.
+func (rt *Runtime) BuiltinAt(index int) Object {
+	if index < 0 || index >= len(rt.builtins) {
+		return newError("no builtin at index %d, the runtime has %d", index, len(rt.builtins))
+	}
+
+	return rt.builtins[index]
+}
+
+// BuiltinNames returns the names of the builtins, followed by those of the
+// functions and modules registered, in the order they were.
+func (rt *Runtime) BuiltinNames() []string {
+	return slices.Clone(rt.names)
+}
+
+func (rt *Runtime) print(args ...Object) Object {
+	return printTo(rt.Stdout, args, "")
+}
+
+func (rt *Runtime) println(args ...Object) Object {
+	return printTo(rt.Stdout, args, "\n")
+}
+
+func (rt *Runtime) eprint(args ...Object) Object {
+	return printTo(rt.Stderr, args, "")
+}
+
+func (rt *Runtime) eprintln(args ...Object) Object {
+	return printTo(rt.Stderr, args, "\n")
+}
+
+func (rt *Runtime) printf(ctx context.Context, args ...Object) Object {
+	return printfTo(ctx, rt.Stdout, args)
+}
+
+func (rt *Runtime) readLine(args ...Object) Object {
+	return readLineFrom(rt.reader(), args)
+}
+
+func (rt *Runtime) input(args ...Object) Object {
+	return inputFrom(rt.Stdout, rt.reader(), args)
+}
+
+func (rt *Runtime) reader() *bufio.Reader {
+	if rt.stdin == nil {
+		rt.stdin = bufio.NewReader(rt.Stdin)
+	}
+
+	return rt.stdin
+}
+
+// macroExpander returns the builtin called name, which expands a copy of the
+// quote it's given with Expand, leaving the quote as it was.
+func (rt *Runtime) macroExpander(name string, all bool) func(ctx context.Context, args ...Object) Object {
+	return func(ctx context.Context, args ...Object) Object {
+		if err := validateLength(1, args); err != nil {
+			return err
+		}
+
+		quote, ok := args[0].(*Quote)
+		if !ok {
+			return notSupported(name, args[0])
+		}
+
+		if rt.Expand == nil {
+			return newError("no macros to expand with")
+		}
+
+		node, err := rt.Expand(ctx, ast.Copy(quote.Node), all)
+		if err != nil {
+			return &Error{Message: err.Error(), Err: err}
+		}
+
+		return &Quote{Node: node}
+	}
+}
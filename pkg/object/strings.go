@@ -0,0 +1,177 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// stringsModule is the strings module. Positions and lengths in it count
+// runes, like indexing a string does, rather than bytes.
+var stringsModule = mustModule("strings", map[string]any{
+	"split":      stringsSplit,
+	"join":       stringsJoin,
+	"trim":       strings.TrimSpace,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"contains":   strings.Contains,
+	"startsWith": strings.HasPrefix,
+	"endsWith":   strings.HasSuffix,
+	"replace":    stringsReplace,
+	"indexOf":    stringsIndexOf,
+	"repeat":     stringsRepeat,
+	"padLeft":    stringsPadLeft,
+	"chars":      stringsChars,
+	"bytes":      stringsBytes,
+})
+
+// stringSize is roughly how many bytes a string takes besides its bytes.
+const stringSize = 32
+
+// The builtins that build strings, or many of them, count their size towards
+// the run's allocation limit before they do, failing if it would overflow.
+
+func stringsSplit(ctx context.Context, s, sep string) ([]string, error) {
+	parts := strings.Count(s, sep) + 1
+	if sep == "" {
+		parts = utf8.RuneCountInString(s)
+	}
+
+	if err := Allocate(ctx, int64(parts)*stringSize); err != nil {
+		return nil, err
+	}
+
+	return strings.Split(s, sep), nil
+}
+
+func stringsJoin(ctx context.Context, parts []string, sep string) (string, error) {
+	size, ok := 0, true
+	for _, part := range parts {
+		if size, ok = grow(size, 1, len(part)); !ok {
+			return "", errTooLong("strings.join")
+		}
+	}
+
+	if len(parts) > 1 {
+		if size, ok = grow(size, len(parts)-1, len(sep)); !ok {
+			return "", errTooLong("strings.join")
+		}
+	}
+
+	if err := Allocate(ctx, int64(size)); err != nil {
+		return "", err
+	}
+
+	return strings.Join(parts, sep), nil
+}
+
+func stringsReplace(ctx context.Context, s, old, new string) (string, error) {
+	count := strings.Count(s, old)
+	if count == 0 {
+		return s, nil
+	}
+
+	size, ok := grow(len(s)-count*len(old), count, len(new))
+	if !ok {
+		return "", errTooLong("strings.replace")
+	}
+
+	if err := Allocate(ctx, int64(size)); err != nil {
+		return "", err
+	}
+
+	return strings.ReplaceAll(s, old, new), nil
+}
+
+// stringsIndexOf returns the position of the first sub in s, or -1 if it's
+// not in s.
+func stringsIndexOf(s, sub string) int {
+	idx := strings.Index(s, sub)
+	if idx < 0 {
+		return idx
+	}
+
+	return utf8.RuneCountInString(s[:idx])
+}
+
+func stringsRepeat(ctx context.Context, s string, count int) (string, error) {
+	if count < 0 {
+		return "", errors.New("negative count to `strings.repeat`")
+	}
+
+	return repeat(ctx, "strings.repeat", s, count)
+}
+
+// stringsPadLeft pads s on the left to width runes with pad, or with spaces
+// if it's not given.
+func stringsPadLeft(ctx context.Context, s string, width int, pad ...string) (string, error) {
+	fill := " "
+	switch len(pad) {
+	case 0:
+	case 1:
+		fill = pad[0]
+	default:
+		return "", fmt.Errorf("wrong number of arguments: expected at most 3, got %d", len(pad)+2)
+	}
+
+	if utf8.RuneCountInString(fill) != 1 {
+		return "", fmt.Errorf("padding for `strings.padLeft` must be a single character, got %q", fill)
+	}
+
+	missing := width - utf8.RuneCountInString(s)
+	if missing <= 0 {
+		return s, nil
+	}
+
+	padding, err := repeat(ctx, "strings.padLeft", fill, missing)
+	if err != nil {
+		return "", err
+	}
+
+	return padding + s, nil
+}
+
+// repeat is strings.Repeat for the builtin called name, failing instead of
+// panicking if the result would be too long, and counting its size towards
+// the run's allocation limit before building it.
+func repeat(ctx context.Context, name, s string, count int) (string, error) {
+	size, ok := grow(0, count, len(s))
+	if !ok {
+		return "", errTooLong(name)
+	}
+
+	if err := Allocate(ctx, int64(size)); err != nil {
+		return "", err
+	}
+
+	return strings.Repeat(s, count), nil
+}
+
+// grow returns size plus count times n, or false if that overflows.
+func grow(size, count, n int) (int, bool) {
+	if n > 0 && count > (math.MaxInt-size)/n {
+		return 0, false
+	}
+
+	return size + count*n, true
+}
+
+func errTooLong(name string) error {
+	return fmt.Errorf("result of `%s` would be too long", name)
+}
+
+func stringsChars(s string) []string {
+	chars := make([]string, 0, utf8.RuneCountInString(s))
+	for _, r := range s {
+		chars = append(chars, string(r))
+	}
+
+	return chars
+}
+
+func stringsBytes(s string) []byte {
+	return []byte(s)
+}
@@ -0,0 +1,427 @@
+// Package optimizer simplifies a program before it runs. It folds
+// arithmetic, comparisons and concatenations of literals, drops the branches
+// of ifs whose condition is a literal, replaces variables bound once to a
+// literal with that literal and removes statements after a return.
+//
+// Nodes it builds take the position of the code they replace, so errors
+// still point at the right place in the source. Anything that would fail at
+// run time, like a division by zero, is left for the run to report.
+package optimizer
+
+import (
+	"strconv"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+// maxPasses bounds how many times the program is rewritten. Each pass can
+// open up more work for the next, like a let that becomes a literal once
+// its value is folded.
+const maxPasses = 8
+
+// Optimize rewrites program in place and returns it.
+func Optimize(program *ast.Program) (*ast.Program, error) {
+	o := &optimizer{bindings: countBindings(program)}
+
+	for pass := 0; pass < maxPasses; pass++ {
+		o.changed = false
+
+		if _, err := ast.Apply(program, notQuoted, o.optimize); err != nil {
+			return nil, err
+		}
+
+		if o.err != nil {
+			return nil, o.err
+		}
+
+		if !o.changed {
+			break
+		}
+	}
+
+	return program, nil
+}
+
+type optimizer struct {
+	// bindings counts how many lets and parameters bind each name
+	bindings map[string]int
+	changed  bool
+	err      error
+}
+
+func (o *optimizer) optimize(node ast.Node) ast.Node {
+	switch node := node.(type) {
+
+	case *ast.Program:
+		node.Statements = o.statements(node.Statements)
+		o.inline(node.Statements, false)
+
+	case *ast.BlockStatement:
+		node.Statements = o.statements(node.Statements)
+
+	case *ast.FunctionLiteral:
+		if node.Body != nil {
+			o.inline(node.Body.Statements, true)
+		}
+
+	case *ast.InfixExpression:
+		if folded := foldInfix(node); folded != nil {
+			o.changed = true
+			return folded
+		}
+
+	case *ast.PrefixExpression:
+		if folded := foldPrefix(node); folded != nil {
+			o.changed = true
+			return folded
+		}
+
+	case *ast.IfExpression:
+		if pruned := o.pruneIf(node); pruned != nil {
+			return pruned
+		}
+	}
+
+	return node
+}
+
+// statements removes the statements that can never run or have no effect
+// and splices in the blocks of ifs that always run.
+func (o *optimizer) statements(stmts []ast.Statement) []ast.Statement {
+	var out []ast.Statement
+
+	for i, stmt := range stmts {
+		last := i == len(stmts)-1
+
+		if block, ok := alwaysRuns(stmt); ok && (len(block.Statements) > 0 || !last) {
+			o.changed = true
+			out = append(out, block.Statements...)
+			if endsInReturn(block.Statements) {
+				break
+			}
+			continue
+		}
+
+		// a literal only matters if it's the value of the list
+		if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && !last && isLiteral(exprStmt.Expression) {
+			o.changed = true
+			continue
+		}
+
+		out = append(out, stmt)
+
+		if _, ok := stmt.(*ast.ReturnStatement); ok {
+			if !last {
+				o.changed = true
+			}
+			break
+		}
+	}
+
+	return out
+}
+
+// pruneIf replaces an if whose condition is a literal with the branch that
+// runs. When that branch isn't a single expression, the if is kept with
+// just that branch, and statements splices it into the enclosing list.
+func (o *optimizer) pruneIf(ie *ast.IfExpression) ast.Expression {
+	truthy, ok := literalTruthiness(ie.Condition)
+	if !ok {
+		return nil
+	}
+
+	branch := ie.Alternative
+	if truthy {
+		branch = ie.Consequence
+	}
+
+	if branch == nil || len(branch.Statements) == 0 {
+		o.changed = true
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: ast.Pos(ie)}}
+	}
+
+	if len(branch.Statements) == 1 {
+		if exprStmt, ok := branch.Statements[0].(*ast.ExpressionStatement); ok && exprStmt.Expression != nil {
+			o.changed = true
+			return exprStmt.Expression
+		}
+	}
+
+	if truthy && ie.Alternative == nil {
+		if b, ok := ie.Condition.(*ast.Boolean); ok && b.Value {
+			// already as simple as it gets
+			return nil
+		}
+	}
+
+	o.changed = true
+	return &ast.IfExpression{
+		Token:       ie.Token,
+		Condition:   newBoolean(true, ast.Pos(ie.Condition)),
+		Consequence: branch,
+	}
+}
+
+// inline replaces the uses of variables bound to a literal by a let in stmts
+// with the literal, in the statements after the let. Only names bound once
+// in the whole program are inlined, so no other variable can shadow or
+// redefine them. Globals aren't inlined into functions, which might run
+// after a later program redefines them.
+func (o *optimizer) inline(stmts []ast.Statement, intoFunctions bool) {
+	for i, stmt := range stmts {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || !isLiteral(let.Value) || o.bindings[let.Name.Value] != 1 {
+			continue
+		}
+
+		for _, later := range stmts[i+1:] {
+			o.replaceUses(later, let.Name.Value, let.Value, intoFunctions)
+		}
+	}
+}
+
+func (o *optimizer) replaceUses(stmt ast.Statement, name string, value ast.Expression, intoFunctions bool) {
+	properties := map[*ast.Identifier]bool{}
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		if member, ok := node.(*ast.MemberExpression); ok {
+			properties[member.Property] = true
+		}
+		return true
+	})
+
+	pre := func(node ast.Node) bool {
+		if _, ok := node.(*ast.FunctionLiteral); ok && !intoFunctions {
+			return false
+		}
+		return notQuoted(node)
+	}
+
+	_, err := ast.Apply(stmt, pre, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || ident.Value != name || properties[ident] {
+			return node
+		}
+
+		o.changed = true
+		return withPos(ast.Copy(value).(ast.Expression), ident.Token.Pos)
+	})
+
+	if err != nil && o.err == nil {
+		o.err = err
+	}
+}
+
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	pos := ast.Pos(ie)
+
+	switch left := ie.Left.(type) {
+
+	case *ast.IntegerLiteral:
+		right, ok := ie.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		l, r := left.Value, right.Value
+
+		switch ie.Operator {
+		case "+":
+			return newInteger(l+r, pos)
+		case "-":
+			return newInteger(l-r, pos)
+		case "*":
+			return newInteger(l*r, pos)
+		case "/":
+			if r == 0 {
+				return nil
+			}
+			return newInteger(l/r, pos)
+		}
+		return compare(ie.Operator, l, r, pos)
+
+	case *ast.StringLiteral:
+		right, ok := ie.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil
+		}
+
+		if ie.Operator == "+" {
+			return newString(left.Value+right.Value, pos)
+		}
+		return compare(ie.Operator, left.Value, right.Value, pos)
+
+	case *ast.Boolean:
+		right, ok := ie.Right.(*ast.Boolean)
+		if !ok {
+			return nil
+		}
+
+		switch ie.Operator {
+		case "==":
+			return newBoolean(left.Value == right.Value, pos)
+		case "!=":
+			return newBoolean(left.Value != right.Value, pos)
+		}
+	}
+
+	return nil
+}
+
+func compare[T int64 | string](operator string, l, r T, pos token.Position) ast.Expression {
+	switch operator {
+	case "<":
+		return newBoolean(l < r, pos)
+	case ">":
+		return newBoolean(l > r, pos)
+	case "==":
+		return newBoolean(l == r, pos)
+	case "!=":
+		return newBoolean(l != r, pos)
+	case "<=":
+		return newBoolean(l <= r, pos)
+	case ">=":
+		return newBoolean(l >= r, pos)
+	default:
+		return nil
+	}
+}
+
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	pos := ast.Pos(pe)
+
+	switch pe.Operator {
+	case "-":
+		if right, ok := pe.Right.(*ast.IntegerLiteral); ok {
+			return newInteger(-right.Value, pos)
+		}
+	case "!":
+		if truthy, ok := literalTruthiness(pe.Right); ok {
+			return newBoolean(!truthy, pos)
+		}
+	}
+
+	return nil
+}
+
+// literalTruthiness reports whether exp is truthy, if it's a literal.
+func literalTruthiness(exp ast.Expression) (truthy bool, ok bool) {
+	switch exp := exp.(type) {
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.NullLiteral:
+		return false, true
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral:
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+func isLiteral(exp ast.Expression) bool {
+	_, ok := literalTruthiness(exp)
+	return ok
+}
+
+// alwaysRuns returns the block of stmt if it's an if that was left with only
+// the branch that runs.
+func alwaysRuns(stmt ast.Statement) (*ast.BlockStatement, bool) {
+	exprStmt, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return nil, false
+	}
+
+	ie, ok := exprStmt.Expression.(*ast.IfExpression)
+	if !ok || ie.Alternative != nil || ie.Consequence == nil {
+		return nil, false
+	}
+
+	if b, ok := ie.Condition.(*ast.Boolean); !ok || !b.Value {
+		return nil, false
+	}
+
+	return ie.Consequence, true
+}
+
+func endsInReturn(stmts []ast.Statement) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+
+	_, ok := stmts[len(stmts)-1].(*ast.ReturnStatement)
+	return ok
+}
+
+// countBindings counts the lets and parameters binding each name anywhere in
+// program, quoted code and macros included.
+func countBindings(program *ast.Program) map[string]int {
+	bindings := map[string]int{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				bindings[node.Name.Value] += 1
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				bindings[param.Value] += 1
+			}
+		case *ast.MacroLiteral:
+			for _, param := range node.Parameters {
+				bindings[param.Value] += 1
+			}
+		}
+		return true
+	})
+
+	return bindings
+}
+
+// notQuoted keeps the optimizer out of quoted code, which is data, and out
+// of macros.
+func notQuoted(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		ident, ok := node.Function.(*ast.Identifier)
+		return !ok || ident.Value != "quote"
+	case *ast.MacroLiteral:
+		return false
+	default:
+		return true
+	}
+}
+
+func newInteger(value int64, pos token.Position) *ast.IntegerLiteral {
+	t := token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Pos: pos}
+	return &ast.IntegerLiteral{Token: t, Value: value}
+}
+
+func newString(value string, pos token.Position) *ast.StringLiteral {
+	t := token.Token{Type: token.STRING, Literal: value, Pos: pos}
+	return &ast.StringLiteral{Token: t, Value: value}
+}
+
+func newBoolean(value bool, pos token.Position) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}
+	}
+
+	return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}
+}
+
+func withPos(exp ast.Expression, pos token.Position) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		exp.Token.Pos = pos
+	case *ast.FloatLiteral:
+		exp.Token.Pos = pos
+	case *ast.StringLiteral:
+		exp.Token.Pos = pos
+	case *ast.Boolean:
+		exp.Token.Pos = pos
+	case *ast.NullLiteral:
+		exp.Token.Pos = pos
+	}
+
+	return exp
+}
@@ -0,0 +1,138 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/parser"
+)
+
+func TestConstantFolding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"60 * 60 * 24", "86400"},
+		{"1 + 2 * 3 - 4 / 2", "5"},
+		{"-(3 - 5)", "2"},
+		{`"a" + "b" + "c"`, "abc"},
+		{"1 < 2", "true"},
+		{`"a" >= "b"`, "false"},
+		{"true == false", "false"},
+		{"!true", "false"},
+		{"!null", "true"},
+		{"!0", "false"},
+		{"1 / 0", "(1 / 0)"},
+		{"x * (2 + 3)", "(x * 5)"},
+		{`1 + "a"`, "(1 + a)"},
+		{"[1 + 1, {2 * 2: 3 - 3}]", "[2, {4:0}]"},
+	}
+
+	for _, tt := range tests {
+		testOptimize(t, tt.input, tt.expected)
+	}
+}
+
+func TestDeadBranches(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { 1 } else { 2 }", "2"},
+		{"if (false) { 1 }", "null"},
+		{"if (null) { 1 } else { }", "null"},
+		{`if ("yes") { let a = f(); a } else { 2 }`, "let a = f();a"},
+		{"let x = if (true) { let a = f(); a }; x", "let x = iftrue let a = f();a;x"},
+		{"if (x) { 1 } else { 2 }", "ifx 1else 2"},
+		{"if (true) { return 1 }; 2", "return 1;"},
+	}
+
+	for _, tt := range tests {
+		testOptimize(t, tt.input, tt.expected)
+	}
+}
+
+func TestInlining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let day = 60 * 60 * 24; day * 7", "let day = 86400;604800"},
+		{"let f = fn(x) { let k = 2; x * k }", "let f = fn(x) let k = 2;(x * 2);"},
+		{"let f = fn() { let k = 2; fn() { k } }", "let f = fn() let k = 2;fn() 2;"},
+		// globals are looked up when a function runs, by then they may
+		// have been redefined
+		{"let k = 2; let f = fn() { k }", "let k = 2;let f = fn() k;"},
+		// names bound more than once are left alone
+		{"let k = 2; let f = fn(k) { k }; k", "let k = 2;let f = fn(k) k;k"},
+		{"let k = 2; let k = 3; k", "let k = 2;let k = 3;k"},
+		{"let k = 2; let m = {}; m.k", "let k = 2;let m = {};(m.k)"},
+		{"let k = f(); k", "let k = f();k"},
+		{"k; let k = 2; k", "klet k = 2;2"},
+	}
+
+	for _, tt := range tests {
+		testOptimize(t, tt.input, tt.expected)
+	}
+}
+
+func TestUnreachableStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { return 1; f(); 2 }", "fn() return 1;"},
+		{"fn(x) { if (x) { return 1; 2 }; 3 }", "fn(x) ifx return 1;3"},
+		{"1; 2; f(); 3", "f()3"},
+	}
+
+	for _, tt := range tests {
+		testOptimize(t, tt.input, tt.expected)
+	}
+}
+
+func TestQuotedCodeIsLeftAlone(t *testing.T) {
+	testOptimize(t, "quote(1 + 2)", "quote((1 + 2))")
+	testOptimize(t, "let x = 1; quote(unquote(x) + 2)", "let x = 1;quote((unquote(x) + 2))")
+}
+
+func TestPositionsAreKept(t *testing.T) {
+	program := optimize(t, "let a = 1;\nlet b = a +\n  2 * 3;\nb")
+
+	let := program.Statements[1].(*ast.LetStatement)
+	if got := ast.Pos(let.Value).String(); got != "2:9" {
+		t.Errorf("wrong position for folded value. want %q, got %q", "2:9", got)
+	}
+
+	last := program.Statements[2].(*ast.ExpressionStatement)
+	if got := ast.Pos(last.Expression).String(); got != "4:1" {
+		t.Errorf("wrong position for inlined value. want %q, got %q", "4:1", got)
+	}
+}
+
+func testOptimize(t *testing.T, input, expected string) {
+	t.Helper()
+
+	if got := optimize(t, input).String(); got != expected {
+		t.Errorf("wrong optimization of %q. want %q, got %q", input, expected, got)
+	}
+}
+
+func optimize(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs)
+	}
+
+	optimized, err := Optimize(program)
+	if err != nil {
+		t.Fatalf("unexpected error for %q: %v", input, err)
+	}
+
+	return optimized
+}
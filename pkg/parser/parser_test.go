@@ -214,6 +214,39 @@ func TestIntegerLiteralExpressions(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpressions(t *testing.T) {
+	input := "2.75;"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	if n := len(program.Statements); n != 1 {
+		t.Fatalf("program.Statements doesn't have 1 statement, got %d", n)
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got %T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.FloatLiteral. got %T", stmt.Expression)
+	}
+
+	if literal.Value != 2.75 {
+		t.Errorf("literal.Value not %g. got %g", 2.75, literal.Value)
+	}
+
+	if tokLiteral := literal.TokenLiteral(); tokLiteral != "2.75" {
+		t.Errorf("literal.TokenLiteral() not %s. got %s", "2.75", tokLiteral)
+	}
+}
+
 func TestStringLiteralExpressions(t *testing.T) {
 	input := `"hello world";`
 
@@ -314,7 +347,9 @@ func TestParsingMapLiteralsStringKeys(t *testing.T) {
 		t.Errorf("mapLiteral.Pairs has wrong length. got %d", n)
 	}
 
-	for key, value := range mapLiteral.Pairs {
+	for _, pair := range mapLiteral.Pairs {
+		key, value := pair.Key, pair.Value
+
 		keyLiteral, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not *ast.StringLiteral. got %T", key)
@@ -361,7 +396,9 @@ func TestParsingMapLiteralsIntegerKeys(t *testing.T) {
 		t.Errorf("mapLiteral.Pairs has wrong length. got %d", n)
 	}
 
-	for key, value := range mapLiteral.Pairs {
+	for _, pair := range mapLiteral.Pairs {
+		key, value := pair.Key, pair.Value
+
 		keyLiteral, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("key is not *ast.IntegerLiteral. got %T", key)
@@ -407,7 +444,9 @@ func TestParsingMapLiteralsBooleanKeys(t *testing.T) {
 		t.Errorf("mapLiteral.Pairs has wrong length. got %d", n)
 	}
 
-	for key, value := range mapLiteral.Pairs {
+	for _, pair := range mapLiteral.Pairs {
+		key, value := pair.Key, pair.Value
+
 		keyLiteral, ok := key.(*ast.Boolean)
 		if !ok {
 			t.Errorf("key is not *ast.Boolean. got %T", key)
@@ -460,7 +499,9 @@ func TestParsingMapLiteralsWithExpressions(t *testing.T) {
 		t.Errorf("mapLiteral.Pairs has wrong length. got %d", n)
 	}
 
-	for key, value := range mapLiteral.Pairs {
+	for _, pair := range mapLiteral.Pairs {
+		key, value := pair.Key, pair.Value
+
 		keyLiteral, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not *ast.StringLiteral. got %T", key)
@@ -477,6 +518,24 @@ func TestParsingMapLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMapLiteralsKeepOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, 3: "c", "d": 4}`
+	expected := `{b:1, a:2, 3:c, d:4}`
+
+	for range 10 {
+		l := lexer.New(input)
+		p := New(l)
+
+		program := p.ParseProgram()
+
+		checkParserErrors(t, p)
+
+		if got := program.String(); got != expected {
+			t.Fatalf("map literal lost its order. want %q, got %q", expected, got)
+		}
+	}
+}
+
 func TestParsingEmptyMapLiteral(t *testing.T) {
 	input := "{}"
 
@@ -506,6 +565,43 @@ func TestParsingEmptyMapLiteral(t *testing.T) {
 	}
 }
 
+func TestParsingSetLiterals(t *testing.T) {
+	input := `{1, 2 * 3, "four"}`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got %T", program.Statements[0])
+	}
+
+	set, ok := stmt.Expression.(*ast.SetLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.SetLiteral. got %T", stmt.Expression)
+	}
+
+	if n := len(set.Elements); n != 3 {
+		t.Fatalf("set.Elements has wrong length. got %d", n)
+	}
+
+	testIntegerLiteral(t, set.Elements[0], 1)
+	testInfixExpression(t, set.Elements[1], 2, "*", 3)
+
+	str, ok := set.Elements[2].(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("set.Elements[2] is not *ast.StringLiteral. got %T", set.Elements[2])
+	}
+
+	if str.Value != "four" {
+		t.Errorf("str.Value not %q. got %q", "four", str.Value)
+	}
+}
+
 func TestParsingIndexExpressions(t *testing.T) {
 	input := "myArray[1 + 1]"
 
@@ -539,6 +635,37 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingMemberExpressions(t *testing.T) {
+	input := "point.x"
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+
+	checkParserErrors(t, p)
+
+	if n := len(program.Statements); n != 1 {
+		t.Fatalf("program.Statements doesn't have 1 statement, got %d", n)
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got %T", program.Statements[0])
+	}
+
+	memberExp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.MemberExpression. got %T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, memberExp.Object, "point") {
+		return
+	}
+
+	testIdentifier(t, memberExp.Property, "x")
+}
+
 func TestBooleanExpression(t *testing.T) {
 	input := "true;"
 
@@ -774,6 +901,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a.b * c.d(e)",
+			"((-(a.b)) * (c.d)(e))",
+		},
+		{
+			"a.b.c[d]",
+			"(((a.b).c)[d])",
+		},
+		{
+			"a + 1 in b == true",
+			"(((a + 1) in b) == true)",
+		},
+		{
+			"{a, b + 1,}",
+			"{a, (b + 1)}",
+		},
 	}
 
 	for _, tt := range tests {
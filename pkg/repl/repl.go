@@ -2,21 +2,26 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 
-	"github.com/estevesnp/dsb/pkg/evaluator"
-	"github.com/estevesnp/dsb/pkg/lexer"
-	"github.com/estevesnp/dsb/pkg/object"
-	"github.com/estevesnp/dsb/pkg/parser"
+	"github.com/estevesnp/dsb/pkg/interpreter"
 )
 
 const PROMPT = ">>  "
 
 func Start(in io.Reader, out io.Writer) {
+	StartWith(interpreter.New(), in, out)
+}
+
+// StartWith runs the REPL on interp, so the caller chooses its backend.
+// What the programs it runs print goes to out too.
+func StartWith(interp *interpreter.Interpreter, in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
-	macroEnv := object.NewEnvironment()
+
+	interp.Runtime().Stdout = out
+	interp.Runtime().Stderr = out
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -27,19 +32,25 @@ func Start(in io.Reader, out io.Writer) {
 
 		line := scanner.Text()
 
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+		evaluated, err := interp.Run(line)
 
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		var parseErr *interpreter.ParseError
+		if errors.As(err, &parseErr) {
+			printParserErrors(out, parseErr.Errors)
 			continue
 		}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
+		var macroErr *interpreter.MacroError
+		if errors.As(err, &macroErr) {
+			fmt.Fprintf(out, "%s\n", macroErr.Error())
+			continue
+		}
 
-		evaluated := evaluator.Eval(expanded, env)
+		var compileErr *interpreter.CompileError
+		if errors.As(err, &compileErr) {
+			fmt.Fprintf(out, "%s\n", compileErr.Error())
+			continue
+		}
 
 		if evaluated == nil {
 			continue
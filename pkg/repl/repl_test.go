@@ -33,3 +33,14 @@ func TestStart(t *testing.T) {
 		}
 	}
 }
+
+func TestStartPrintsToOut(t *testing.T) {
+	out := &strings.Builder{}
+
+	Start(strings.NewReader(`println("hi", 1); eprintln("oops")`), out)
+
+	expected := PROMPT + "hi 1\noops\nnull\n" + PROMPT
+	if got := out.String(); got != expected {
+		t.Errorf("wrong output. want %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,314 @@
+// Package resolver works out, before a program runs, which variable every
+// identifier refers to. Locals are given a slot in their function's Scope
+// and identifiers a Binding, so the evaluator can find variables by index
+// instead of searching each environment by name. Along the way it reports
+// identifiers that aren't defined anywhere and bindings that are never used.
+package resolver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+type DiagnosticKind int
+
+const (
+	Undefined DiagnosticKind = iota
+	Unused
+)
+
+type Diagnostic struct {
+	Kind DiagnosticKind
+	Name string
+	Pos  token.Position
+}
+
+func (d Diagnostic) String() string {
+	switch d.Kind {
+	case Undefined:
+		return fmt.Sprintf("%s: identifier not found: %s", d.Pos, d.Name)
+	default:
+		return fmt.Sprintf("%s: %s is never used", d.Pos, d.Name)
+	}
+}
+
+// Resolver resolves programs run one after the other in the same global
+// environment, like the inputs of a REPL, so it remembers the globals
+// defined by earlier programs.
+type Resolver struct {
+	globals  map[string]bool
+	builtins map[string]bool
+}
+
+func New() *Resolver {
+	r := &Resolver{
+		globals:  map[string]bool{},
+		builtins: map[string]bool{},
+	}
+
+	for _, def := range object.Builtins {
+		r.builtins[def.Name] = true
+	}
+
+	return r
+}
+
+// Declare records name as a global defined outside of any program, like a
+// value set by the program embedding dsb.
+func (r *Resolver) Declare(name string) {
+	r.globals[name] = true
+}
+
+// DeclareBuiltin records name as a builtin, like a function registered by
+// the program embedding dsb, which is never reported as undefined.
+func (r *Resolver) DeclareBuiltin(name string) {
+	r.builtins[name] = true
+}
+
+// Resolve fills in the Binding of every identifier in program that refers
+// to a variable and the Scope of every function literal. Code inside quote
+// is data and is left alone, except for the arguments of its unquote calls.
+// Macro literals are skipped too, since their bodies run while expanding,
+// before resolution.
+//
+// Resolving never stops a program from running: identifiers reported as
+// undefined are still looked up by name and fail at run time if they're
+// still missing. Unused bindings whose names start with an underscore
+// aren't reported.
+func (r *Resolver) Resolve(program *ast.Program) []Diagnostic {
+	res := &resolution{resolver: r}
+
+	global := newScope(nil, nil)
+	for name := range r.globals {
+		global.declare(name, token.Position{}).used = true
+	}
+
+	res.scope = global
+	res.hoist(program)
+	res.statements(program.Statements)
+	res.closeScope()
+
+	for name := range global.slots {
+		r.globals[name] = true
+	}
+
+	sort.SliceStable(res.diagnostics, func(i, j int) bool {
+		a, b := res.diagnostics[i].Pos, res.diagnostics[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return res.diagnostics
+}
+
+type variable struct {
+	name string
+	pos  token.Position
+	slot int
+	used bool
+}
+
+type scope struct {
+	outer *scope
+
+	// fn is the Scope of the function this scope belongs to, nil for the
+	// global scope, whose variables are looked up by name
+	fn *ast.Scope
+
+	slots     map[string]*variable
+	variables []*variable
+}
+
+func newScope(outer *scope, fn *ast.Scope) *scope {
+	return &scope{outer: outer, fn: fn, slots: map[string]*variable{}}
+}
+
+// declare adds name to s, reusing its slot if s already has it, like a let
+// that redefines a variable in the same function.
+func (s *scope) declare(name string, pos token.Position) *variable {
+	if v, ok := s.slots[name]; ok {
+		return v
+	}
+
+	return s.add(name, pos)
+}
+
+// add gives name a new slot even if s already has it, which only happens
+// for repeated parameters, where the last one wins.
+func (s *scope) add(name string, pos token.Position) *variable {
+	v := &variable{name: name, pos: pos, slot: -1}
+	if s.fn != nil {
+		v.slot = len(s.fn.Names)
+		s.fn.Names = append(s.fn.Names, name)
+	}
+
+	s.slots[name] = v
+	s.variables = append(s.variables, v)
+
+	return v
+}
+
+type resolution struct {
+	resolver    *Resolver
+	scope       *scope
+	diagnostics []Diagnostic
+}
+
+// hoist declares every let in node that belongs to the current scope before
+// any of it is resolved, so functions can refer to variables defined after
+// them.
+func (res *resolution) hoist(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				res.scope.declare(node.Name.Value, node.Name.Token.Pos)
+			}
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.CallExpression:
+			return !isCallTo(node, "quote")
+		}
+		return true
+	})
+}
+
+func (res *resolution) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		res.node(stmt)
+	}
+}
+
+func (res *resolution) node(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+
+		case *ast.LetStatement:
+			res.node(node.Value)
+			res.define(node.Name)
+			return false
+
+		case *ast.Identifier:
+			res.identifier(node)
+			return false
+
+		case *ast.MemberExpression:
+			res.node(node.Object)
+			return false
+
+		case *ast.FunctionLiteral:
+			res.function(node)
+			return false
+
+		case *ast.MacroLiteral:
+			return false
+
+		case *ast.CallExpression:
+			switch node.Function.TokenLiteral() {
+			case "quote":
+				res.quoted(node.Arguments)
+				return false
+			case "macroexpand", "macroexpand1":
+				for _, arg := range node.Arguments {
+					res.node(arg)
+				}
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+func (res *resolution) define(ident *ast.Identifier) {
+	if ident == nil {
+		return
+	}
+
+	v := res.scope.declare(ident.Value, ident.Token.Pos)
+	if res.scope.fn == nil {
+		ident.Binding = nil
+		return
+	}
+
+	ident.Binding = &ast.Binding{Depth: 0, Slot: v.slot}
+}
+
+func (res *resolution) identifier(ident *ast.Identifier) {
+	ident.Binding = nil
+
+	depth := 0
+	for s := res.scope; s != nil; s = s.outer {
+		if v, ok := s.slots[ident.Value]; ok {
+			v.used = true
+			ident.Binding = &ast.Binding{Depth: depth, Slot: v.slot}
+			return
+		}
+
+		if s.fn != nil {
+			depth += 1
+		}
+	}
+
+	if !res.resolver.builtins[ident.Value] {
+		res.report(Undefined, ident.Value, ident.Token.Pos)
+	}
+}
+
+func (res *resolution) function(fl *ast.FunctionLiteral) {
+	fl.Scope = &ast.Scope{}
+	res.scope = newScope(res.scope, fl.Scope)
+
+	for _, param := range fl.Parameters {
+		v := res.scope.add(param.Value, param.Token.Pos)
+		param.Binding = &ast.Binding{Depth: 0, Slot: v.slot}
+	}
+
+	if fl.Body != nil {
+		res.hoist(fl.Body)
+		res.statements(fl.Body.Statements)
+	}
+
+	res.closeScope()
+}
+
+// quoted resolves the arguments of the unquote and unquote_splice calls in
+// a quote's arguments, which run in the quote's scope.
+func (res *resolution) quoted(args []ast.Expression) {
+	for _, arg := range args {
+		ast.Inspect(arg, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpression)
+			if !ok || !(isCallTo(call, "unquote") || isCallTo(call, "unquote_splice")) {
+				return true
+			}
+
+			for _, arg := range call.Arguments {
+				res.node(arg)
+			}
+			return false
+		})
+	}
+}
+
+func (res *resolution) closeScope() {
+	for _, v := range res.scope.variables {
+		if !v.used && v.pos.IsValid() && !strings.HasPrefix(v.name, "_") {
+			res.report(Unused, v.name, v.pos)
+		}
+	}
+
+	res.scope = res.scope.outer
+}
+
+func (res *resolution) report(kind DiagnosticKind, name string, pos token.Position) {
+	res.diagnostics = append(res.diagnostics, Diagnostic{Kind: kind, Name: name, Pos: pos})
+}
+
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/parser"
+)
+
+func TestBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]*ast.Binding
+	}{
+		{
+			"let x = 1; x",
+			map[string]*ast.Binding{"x": {Depth: 0, Slot: -1}},
+		},
+		{
+			"let g = 1; fn(a) { let b = 2; fn(c) { a + b + c + g } }",
+			map[string]*ast.Binding{
+				"a": {Depth: 1, Slot: 0},
+				"b": {Depth: 1, Slot: 1},
+				"c": {Depth: 0, Slot: 0},
+				"g": {Depth: 2, Slot: -1},
+			},
+		},
+		{
+			"fn() { f(); let f = fn() { 1 } }",
+			map[string]*ast.Binding{"f": {Depth: 0, Slot: 0}},
+		},
+		{
+			"len([])",
+			map[string]*ast.Binding{"len": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		New().Resolve(program)
+
+		for name, want := range tt.expected {
+			for _, got := range uses(program, name) {
+				if (got == nil) != (want == nil) || got != nil && *got != *want {
+					t.Errorf("wrong binding for %s in %q. want %+v, got %+v", name, tt.input, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	program := parse(t, "fn(a, b) { let c = 1; if (a) { let d = 2 }; let c = 3; fn(e) { e } }")
+	New().Resolve(program)
+
+	var scopes [][]string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fl, ok := node.(*ast.FunctionLiteral); ok {
+			scopes = append(scopes, fl.Scope.Names)
+		}
+		return true
+	})
+
+	expected := [][]string{{"a", "b", "c", "d"}, {"e"}}
+	if len(scopes) != len(expected) {
+		t.Fatalf("wrong number of scopes. want %d, got %d", len(expected), len(scopes))
+	}
+
+	for i, names := range expected {
+		if len(scopes[i]) != len(names) {
+			t.Errorf("wrong names in scope %d. want %v, got %v", i, names, scopes[i])
+			continue
+		}
+		for j, name := range names {
+			if scopes[i][j] != name {
+				t.Errorf("wrong names in scope %d. want %v, got %v", i, names, scopes[i])
+				break
+			}
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; x", nil},
+		{"missing", []string{"1:1: identifier not found: missing"}},
+		{"let x = 1;", []string{"1:5: x is never used"}},
+		{
+			"let f = fn(a, b) { let c = a; y }; f",
+			[]string{
+				"1:15: b is never used",
+				"1:24: c is never used",
+				"1:31: identifier not found: y",
+			},
+		},
+		{"let f = fn(_a) { 1 }; let _g = 2; f", nil},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f", nil},
+		{"let x = 1; quote(unquote(x) + y)", nil},
+		{"let m = {}; m.missing", nil},
+		{"puts(len([]))", []string{"1:1: identifier not found: puts"}},
+		{"macroexpand(quote(m(1)))", nil},
+		{"macro(a) { b }", nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics := New().Resolve(parse(t, tt.input))
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q. want %v, got %v", tt.input, tt.expected, diagnostics)
+			continue
+		}
+
+		for i, want := range tt.expected {
+			if got := diagnostics[i].String(); got != want {
+				t.Errorf("wrong diagnostic for %q. want %q, got %q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestGlobalsPersistAcrossPrograms(t *testing.T) {
+	r := New()
+
+	r.Resolve(parse(t, "let x = 1;"))
+
+	if diagnostics := r.Resolve(parse(t, "x")); len(diagnostics) != 0 {
+		t.Errorf("expected x to be known from the previous program, got %v", diagnostics)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, errs)
+	}
+
+	return program
+}
+
+// uses returns the bindings of the identifiers named name in program that
+// aren't being defined by a let or a parameter list.
+func uses(program *ast.Program, name string) []*ast.Binding {
+	definitions := map[*ast.Identifier]bool{}
+	var bindings []*ast.Binding
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			definitions[node.Name] = true
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				definitions[param] = true
+			}
+		case *ast.Identifier:
+			if node.Value == name && !definitions[node] {
+				bindings = append(bindings, node.Binding)
+			}
+		}
+		return true
+	})
+
+	return bindings
+}
@@ -1,10 +1,30 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -14,6 +34,7 @@ const (
 	// Identifiers + Literals
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 
 	// Operators
@@ -33,6 +54,7 @@ const (
 
 	// Delimiters
 	COMMA     = ","
+	DOT       = "."
 	SEMICOLON = ";"
 	COLON     = ":"
 	LPAREN    = "("
@@ -52,6 +74,7 @@ const (
 	RETURN   = "RETURN"
 	NULL     = "NULL"
 	MACRO    = "MACRO"
+	IN       = "IN"
 )
 
 var keywords = map[string]TokenType{
@@ -64,6 +87,7 @@ var keywords = map[string]TokenType{
 	"return": RETURN,
 	"null":   NULL,
 	"macro":  MACRO,
+	"in":     IN,
 }
 
 func LookupIdent(ident string) TokenType {
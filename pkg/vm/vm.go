@@ -0,0 +1,780 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/code"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/token"
+)
+
+const (
+	StackSize   = 1 << 16
+	GlobalsSize = 1 << 16
+	MaxFrames   = 1 << 12
+
+	// initialStackSize is where the stack starts, it doubles as needed up
+	// to StackSize
+	initialStackSize = 1 << 10
+)
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLessThan:     "<",
+	code.OpGreaterThan:  ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpIn:           "in",
+}
+
+// RuntimeError is returned by Run when the program fails. Its message is
+// the same the evaluator puts in an *object.Error, Pos is where in the
+// source the failing instruction came from, if known.
+type RuntimeError struct {
+	Message string
+	Pos     token.Position
+
+	// Err is what caused the error, if it didn't come from the program
+	// itself, like one of the limits being exceeded.
+	Err error
+}
+
+func (re *RuntimeError) Error() string {
+	return re.Message
+}
+
+func (re *RuntimeError) Unwrap() error {
+	return re.Err
+}
+
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top is stack[sp-1]
+
+	// frames grows as calls nest, up to maxFrames calls past the main frame
+	frames      []*Frame
+	framesIndex int
+	maxFrames   int
+
+	runtime *object.Runtime
+
+	// meter is nil unless SetLimits was called
+	meter *limits.Meter
+
+	lastPopped object.Object
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, len(bytecode.Globals)))
+}
+
+// NewWithGlobalsStore returns a VM that reads and writes globals in s, so
+// consecutive programs compiled with the same symbol table share them. s
+// must have room for every global, GlobalsSize is always enough.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.Globals,
+
+		stack: make([]object.Object, initialStackSize),
+		sp:    0,
+
+		frames:      []*Frame{NewFrame(mainClosure, 0)},
+		framesIndex: 1,
+		maxFrames:   MaxFrames,
+
+		runtime: object.NewRuntime(),
+	}
+}
+
+// SetRuntime makes the program call the builtins of rt, instead of those of
+// a Runtime of its own.
+func (vm *VM) SetRuntime(rt *object.Runtime) {
+	vm.runtime = rt
+}
+
+// SetLimits makes Run stop with an error once ctx is done or the program
+// goes over one of lim's limits. The depth limit defaults to MaxFrames, and
+// can't go over StackSize, since every call takes at least a slot of the
+// stack.
+func (vm *VM) SetLimits(ctx context.Context, lim limits.Limits) {
+	vm.meter = limits.NewMeter(ctx, lim)
+	vm.maxFrames = min(vm.meter.MaxDepth(MaxFrames), StackSize)
+}
+
+// context returns the context of the run, which builtins get.
+func (vm *VM) context() context.Context {
+	if vm.meter == nil {
+		return context.Background()
+	}
+
+	return vm.meter.Context()
+}
+
+// LastPoppedStackElem returns the value of the program's last statement
+// once Run has finished.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.lastPopped
+}
+
+func (vm *VM) Run() error {
+	return vm.run(0)
+}
+
+// run executes instructions until the number of frames drops to depth.
+func (vm *VM) run(depth int) error {
+	for vm.framesIndex > depth {
+		frame := vm.frames[vm.framesIndex-1]
+		ins := frame.Instructions()
+
+		if frame.ip >= len(ins)-1 {
+			// only the main program runs off the end of its instructions
+			vm.framesIndex -= 1
+			continue
+		}
+
+		frame.ip += 1
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		if vm.meter != nil {
+			if err := vm.meter.Step(); err != nil {
+				return &RuntimeError{Message: err.Error(), Pos: frame.cl.Fn.Positions.Lookup(ip), Err: err}
+			}
+		}
+
+		var err error
+
+		switch op {
+
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.lastPopped = vm.pop()
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+
+		case code.OpFalse:
+			err = vm.push(FALSE)
+
+		case code.OpNull:
+			err = vm.push(NULL)
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpLessThan, code.OpGreaterThan,
+			code.OpLessEqual, code.OpGreaterEqual, code.OpIn:
+			right := vm.pop()
+			left := vm.pop()
+
+			var result object.Object
+			if result, err = vm.executeInfixOperation(op, left, right); err == nil {
+				err = vm.pushNew(result)
+			}
+
+		case code.OpBang:
+			err = vm.push(object.Prefix("!", vm.pop()))
+
+		case code.OpMinus:
+			var result object.Object
+			if result, err = operatorResult(object.Prefix("-", vm.pop())); err == nil {
+				err = vm.pushNew(result)
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if !isTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			global := vm.globals[globalIndex]
+			if global == nil {
+				err = newError("identifier not found: %s", vm.globalName(int(globalIndex)))
+				break
+			}
+			err = vm.push(global)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			builtin := vm.runtime.BuiltinAt(int(builtinIndex))
+			if errObj, ok := builtin.(*object.Error); ok {
+				err = &RuntimeError{Message: errObj.Message}
+			} else {
+				err = vm.push(builtin)
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			free := frame.cl.Free[freeIndex]
+			if cell, ok := free.(*object.Cell); ok {
+				err = vm.pushCell(cell)
+			} else {
+				err = vm.push(free)
+			}
+
+		case code.OpGetFreeCell:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.push(frame.cl.Free[freeIndex])
+
+		case code.OpGetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.pushCell(vm.stack[frame.basePointer+int(localIndex)].(*object.Cell))
+
+		case code.OpSetCell:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			vm.stack[frame.basePointer+int(localIndex)].(*object.Cell).Value = vm.pop()
+
+		case code.OpBoxLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			nameIndex := code.ReadUint16(ins[ip+2:])
+			frame.ip += 3
+
+			cell := &object.Cell{Name: vm.constants[nameIndex].(*object.String).Value}
+			slot := &vm.stack[frame.basePointer+localIndex]
+			if localIndex < frame.cl.Fn.NumParameters {
+				// a parameter keeps its argument, a let starts unbound
+				cell.Value = *slot
+			}
+			*slot = cell
+
+			err = vm.allocate(limits.SizeOf(cell))
+
+		case code.OpCurrentClosure:
+			err = vm.push(frame.cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp -= numElements
+
+			err = vm.pushNew(&object.Array{Elements: elements})
+
+		case code.OpMap:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var m object.Object
+			if m, err = vm.buildMap(vm.sp-numElements, vm.sp); err == nil {
+				vm.sp -= numElements
+				err = vm.pushNew(m)
+			}
+
+		case code.OpSetLiteral:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var set object.Object
+			if set, err = vm.buildSet(vm.sp-numElements, vm.sp); err == nil {
+				vm.sp -= numElements
+				err = vm.pushNew(set)
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			var result object.Object
+			if result, err = vm.executeIndexExpression(left, index); err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpMember:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			name := vm.constants[nameIndex].(*object.String).Value
+
+			var result object.Object
+			if result, err = vm.executeMemberExpression(vm.pop(), name); err == nil {
+				err = vm.push(result)
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.executeCall(int(numArgs), false)
+
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+			err = vm.executeCall(int(numArgs), true)
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			vm.framesIndex -= 1
+			if vm.framesIndex == 0 {
+				// a return in the main program ends it
+				vm.lastPopped = returnValue
+				break
+			}
+
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			frame.ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numUnquoted := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			var quote object.Object
+			if quote, err = vm.buildQuote(int(constIndex), vm.sp-numUnquoted, vm.sp); err == nil {
+				vm.sp -= numUnquoted
+				err = vm.pushNew(quote)
+			}
+
+		default:
+			err = fmt.Errorf("unknown opcode %d", op)
+		}
+
+		if err != nil {
+			if re, ok := err.(*RuntimeError); ok && !re.Pos.IsValid() {
+				re.Pos = frame.cl.Fn.Positions.Lookup(ip)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= len(vm.stack) {
+		if err := vm.growStack(vm.sp + 1); err != nil {
+			return err
+		}
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp += 1
+
+	return nil
+}
+
+// growStack makes room for size values on the stack. Running out of it
+// means the calls are nested too deep for their locals and arguments, even
+// if there are fewer than maxFrames of them.
+func (vm *VM) growStack(size int) error {
+	if size > StackSize {
+		return limitError(fmt.Errorf("%w: the stack is full at %d nested calls", limits.ErrDepth, vm.framesIndex-1))
+	}
+
+	newSize := len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+
+	stack := make([]object.Object, min(newSize, StackSize))
+	copy(stack, vm.stack[:vm.sp])
+	vm.stack = stack
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp -= 1
+	return o
+}
+
+// pushCell pushes the value of a captured local, which is an error if it
+// isn't bound yet.
+func (vm *VM) pushCell(cell *object.Cell) error {
+	if cell.Value == nil {
+		return newError("identifier not found: %s", cell.Name)
+	}
+
+	return vm.push(cell.Value)
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+
+	return fmt.Sprintf("global %d", index)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	fn, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp -= numFree
+
+	return vm.pushNew(&object.Closure{Fn: fn, Free: free})
+}
+
+// executeCall calls the function found below its numArgs arguments on the
+// stack. Closures get a new frame, or replace the current one in a tail
+// call, since the caller would only return their result. Everything else
+// runs to completion and leaves its result in place of the function and its
+// arguments.
+func (vm *VM) executeCall(numArgs int, tail bool) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return newError("wrong number of arguments: expected %d, got %d", callee.Fn.NumParameters, numArgs)
+		}
+
+		// the main frame isn't a call, so it doesn't count
+		if !tail && vm.framesIndex > vm.maxFrames {
+			return limitError(limits.DepthError(vm.maxFrames))
+		}
+
+		if err := vm.allocate(limits.EnvironmentSize(callee.Fn.NumLocals)); err != nil {
+			return err
+		}
+
+		basePointer := vm.sp - numArgs
+		if tail {
+			basePointer = vm.frames[vm.framesIndex-1].basePointer
+		}
+
+		if size := basePointer + callee.Fn.NumLocals; size >= len(vm.stack) {
+			if err := vm.growStack(size + 1); err != nil {
+				return err
+			}
+		}
+
+		if tail {
+			// move the callee and its arguments over the caller's
+			copy(vm.stack[basePointer-1:], vm.stack[vm.sp-numArgs-1:vm.sp])
+			vm.framesIndex -= 1
+		}
+
+		if vm.framesIndex == len(vm.frames) {
+			vm.frames = append(vm.frames, &Frame{})
+		}
+		frame := vm.frames[vm.framesIndex]
+		frame.cl, frame.ip, frame.basePointer = callee, -1, basePointer
+		vm.framesIndex += 1
+
+		vm.sp = basePointer + callee.Fn.NumLocals
+
+		return nil
+
+	case *object.Builtin:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.pushResult(callee.Call(vm.context(), args))
+
+	case *object.BoundMethod:
+		// make room for the receiver as the first argument
+		if err := vm.push(nil); err != nil {
+			return err
+		}
+		copy(vm.stack[vm.sp-numArgs:vm.sp], vm.stack[vm.sp-numArgs-1:vm.sp-1])
+		vm.stack[vm.sp-numArgs-1] = callee.Receiver
+		vm.stack[vm.sp-numArgs-2] = callee.Method
+
+		return vm.executeCall(numArgs+1, tail)
+
+	case *object.UserType:
+		args := make([]object.Object, numArgs)
+		copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+		vm.sp = vm.sp - numArgs - 1
+
+		return vm.pushResult(object.NewInstance(callee, args))
+
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+// pushResult pushes the result of a builtin, turning an *object.Error into
+// a runtime error.
+func (vm *VM) pushResult(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return &RuntimeError{Message: errObj.Message, Err: errObj.Err}
+	}
+
+	if result == nil {
+		result = NULL
+	}
+
+	return vm.pushNew(result)
+}
+
+// pushNew pushes o, which was just created, counting it towards the
+// allocation limit.
+func (vm *VM) pushNew(o object.Object) error {
+	if err := vm.allocate(limits.SizeOf(o)); err != nil {
+		return err
+	}
+
+	return vm.push(o)
+}
+
+func (vm *VM) allocate(size int64) error {
+	if vm.meter == nil {
+		return nil
+	}
+
+	if err := vm.meter.Alloc(size); err != nil {
+		return limitError(err)
+	}
+
+	return nil
+}
+
+// Call calls fn with args and runs it to completion, for Go code to call the
+// functions of a program that has already run.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	return vm.callFunction(fn, args)
+}
+
+// callFunction calls fn from Go code and runs it to completion.
+func (vm *VM) callFunction(fn object.Object, args []object.Object) (object.Object, error) {
+	depth := vm.framesIndex
+
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := vm.executeCall(len(args), false); err != nil {
+		return nil, err
+	}
+
+	if err := vm.run(depth); err != nil {
+		return nil, err
+	}
+
+	return vm.pop(), nil
+}
+
+func (vm *VM) buildMap(startIndex, endIndex int) (object.Object, error) {
+	m := object.NewMap()
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if !object.IsHashable(key) {
+			return nil, newError("unusable as hash key: %s", key.Type())
+		}
+
+		m.Set(key.(object.Hashable), value)
+	}
+
+	return m, nil
+}
+
+func (vm *VM) buildSet(startIndex, endIndex int) (object.Object, error) {
+	set := object.NewSet()
+
+	for i := startIndex; i < endIndex; i++ {
+		el := vm.stack[i]
+
+		if !object.IsHashable(el) {
+			return nil, newError("unusable as set element: %s", el.Type())
+		}
+
+		set.Add(el.(object.Hashable))
+	}
+
+	return set, nil
+}
+
+func (vm *VM) buildQuote(constIndex, startIndex, endIndex int) (object.Object, error) {
+	template := vm.constants[constIndex].(*object.Quote)
+	values := vm.stack[startIndex:endIndex]
+
+	next := 0
+	node, err := object.Unquote(ast.Copy(template.Node), func(ast.Node) object.Object {
+		value := values[next]
+		next += 1
+		return value
+	})
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+
+	return &object.Quote{Node: node}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) (object.Object, error) {
+	if method, ok := object.LookupMethod(left, "[]"); ok {
+		return vm.callFunction(method, []object.Object{left, index})
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return nil, newError("index operator not supported: %s", left.Type())
+		}
+
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return NULL, nil
+		}
+
+		return left.Elements[idx.Value], nil
+
+	case *object.String:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return nil, newError("index operator not supported: %s", left.Type())
+		}
+
+		char, ok := left.RuneAt(idx.Value)
+		if !ok {
+			return NULL, nil
+		}
+
+		return char, nil
+
+	case *object.Map:
+		return executeMapIndex(left, index)
+
+	default:
+		return nil, newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func executeMapIndex(m *object.Map, index object.Object) (object.Object, error) {
+	if !object.IsHashable(index) {
+		return nil, newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := m.Get(index.(object.Hashable))
+	if !ok {
+		return NULL, nil
+	}
+
+	return pair.Value, nil
+}
+
+func (vm *VM) executeMemberExpression(obj object.Object, name string) (object.Object, error) {
+	if method, ok := object.LookupMethod(obj, name); ok {
+		return &object.BoundMethod{Receiver: obj, Method: method}, nil
+	}
+
+	m, ok := obj.(*object.Map)
+	if !ok {
+		return nil, newError("member access not supported: %s.%s", obj.Type(), name)
+	}
+
+	return executeMapIndex(m, &object.String{Value: name})
+}
+
+func (vm *VM) executeInfixOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	operator := infixOperators[op]
+
+	method, args, negate, ok := object.Overload(operator, left, right)
+	if !ok {
+		return operatorResult(object.Infix(operator, left, right))
+	}
+
+	result, err := vm.callFunction(method, args)
+	if err != nil || !negate {
+		return result, err
+	}
+
+	return object.NativeBoolToBooleanObject(!isTruthy(result)), nil
+}
+
+// operatorResult turns the *object.Error an operator returns into a
+// runtime error.
+func operatorResult(result object.Object) (object.Object, error) {
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Message: errObj.Message, Err: errObj.Err}
+	}
+
+	return result, nil
+}
+
+func isTruthy(obj object.Object) bool {
+	return obj != NULL && obj != FALSE
+}
+
+func newError(format string, args ...any) *RuntimeError {
+	return &RuntimeError{Message: fmt.Sprintf(format, args...)}
+}
+
+func limitError(err error) *RuntimeError {
+	return &RuntimeError{Message: err.Error(), Err: err}
+}
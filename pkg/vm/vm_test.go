@@ -0,0 +1,278 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/estevesnp/dsb/pkg/ast"
+	"github.com/estevesnp/dsb/pkg/compiler"
+	"github.com/estevesnp/dsb/pkg/evaluator"
+	"github.com/estevesnp/dsb/pkg/lexer"
+	"github.com/estevesnp/dsb/pkg/limits"
+	"github.com/estevesnp/dsb/pkg/object"
+	"github.com/estevesnp/dsb/pkg/parser"
+	"github.com/estevesnp/dsb/pkg/resolver"
+)
+
+type vmTestCase struct {
+	input    string
+	expected any
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newAdder = fn(a) { fn(b) { a + b } }; newAdder(2)(3)", 5},
+		{
+			`let outer = fn() {
+				let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+				fact(5)
+			};
+			outer()`,
+			120,
+		},
+		{"let f = fn() { g() }; let g = fn() { 7 }; f()", 7},
+		{"let x = 1; let getX = fn() { x }; let x = 2; getX()", 2},
+		{"fn(a, b) { let c = a + b; c * 2 }(1, 2)", 6},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 1; 2", 1},
+		{"if (true) { if (true) { return 3 } 4 } 5", 3},
+		{"fn() { if (false) { 1 } else { return 2 }; 3 }()", 2},
+		{"fn(x) { if (x) { 1 } else { 2 } }(false)", 2},
+		{"fn() { let x = 5 }()", 5},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestMethodsAndOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let Point = type("Point", {
+				"==": fn(a, b) { a.x == b.x },
+				"<": fn(a, b) { a.x < b.x },
+				"[]": fn(p, i) { p.x * i },
+				"scale": fn(p, n) { Point({"x": p.x * n}) },
+			});
+			let p = Point({"x": 2});
+			[p == Point({"x": 2}), p != Point({"x": 3}), p >= Point({"x": 1}), p[10], p.scale(3).x]`,
+			[]any{true, true, true, 20, 6},
+		},
+		{"let m = {\"a\": 1}; m.a + m[\"a\"]", 2},
+		{"sort([3, 1, 2])", []any{1, 2, 3}},
+		{"2 in {1, 2}", true},
+	}
+
+	runVMTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"missing", "identifier not found: missing"},
+		{"fn() { missing }()", "identifier not found: missing"},
+		{"fn() { let f = fn() { later }; f(); let later = 1 }()", "identifier not found: later"},
+		{"1 / 0", "unsupported operation: division by zero"},
+		{"fn(a) { a }()", "wrong number of arguments: expected 1, got 0"},
+		{"1()", "not a function: INTEGER"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "stack overflow: more than 4096 nested calls"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. want %q, got %q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestDepthLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected error
+	}{
+		// the stack runs out before the frames do
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(50000)", 100000, limits.ErrDepth},
+		// frames are only made as calls nest
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(10)", 1000000000, nil},
+		{"let f = fn() { f() + 1 }; f()", 1000000000, limits.ErrDepth},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		machine.SetLimits(context.Background(), limits.Limits{MaxDepth: tt.maxDepth})
+
+		if err := machine.Run(); !errors.Is(err, tt.expected) {
+			t.Errorf("wrong error for %q with a max depth of %d. want %v, got %v", tt.input, tt.maxDepth, tt.expected, err)
+		}
+	}
+}
+
+func TestMissingBuiltin(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	symbolTable.DefineBuiltin(200, "missing")
+
+	comp := compiler.NewWithState(symbolTable, nil)
+	if err := comp.Compile(parse("missing")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+
+	expected := fmt.Sprintf("no builtin at index 200, the runtime has %d", len(object.Builtins))
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want %q, got %v", expected, err)
+	}
+}
+
+func TestSharedGlobals(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, def := range object.Builtins {
+		symbolTable.DefineBuiltin(i, def.Name)
+	}
+
+	var constants []object.Object
+	globals := make([]object.Object, GlobalsSize)
+
+	run := func(input string) object.Object {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		return machine.LastPoppedStackElem()
+	}
+
+	run("let double = fn(x) { x * 2 };")
+	testExpectedObject(t, run("double(21)"), 42)
+}
+
+func runVMTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, machine.LastPoppedStackElem(), tt.expected)
+	}
+}
+
+func testExpectedObject(t *testing.T, actual object.Object, expected any) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("object is not Integer %d. got %T (%+v)", expected, actual, actual)
+		}
+
+	case bool:
+		boolean, ok := actual.(*object.Boolean)
+		if !ok || boolean.Value != expected {
+			t.Errorf("object is not Boolean %t. got %T (%+v)", expected, actual, actual)
+		}
+
+	case []any:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong number of elements. want %d, got %d", len(expected), len(array.Elements))
+			return
+		}
+
+		for i, el := range expected {
+			testExpectedObject(t, array.Elements[i], el)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+const fibonacci = `
+let fibonacci = fn(x) {
+	if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) }
+};
+fibonacci(20);`
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			b.Fatal(err)
+		}
+
+		if err := New(comp.Bytecode()).Run(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibonacciEvaluator(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}
+
+func BenchmarkFibonacciResolvedEvaluator(b *testing.B) {
+	program := parse(fibonacci)
+	resolver.New().Resolve(program)
+
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(program, object.NewEnvironment())
+	}
+}